@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"ltv-monthly/pkg/calculator"
+	"ltv-monthly/pkg/database"
+	"ltv-monthly/pkg/filesource"
+	"ltv-monthly/pkg/fx"
+	"ltv-monthly/pkg/models"
+)
+
+// parseIntList convertit une liste "7,8, 9" en []int ; une chaîne vide donne nil.
+func parseIntList(s string) ([]int, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var out []int
+	for _, part := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("entier invalide %q", part)
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+// parseStringList convertit une liste "a, b" en []string ; une chaîne vide donne nil.
+func parseStringList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// schemaFlags déclare sur fs les flags du mapping de schéma et renvoie une fonction
+// qui construit le models.Schema correspondant une fois fs.Parse appelé.
+func schemaFlags(fs *flag.FlagSet) func() models.Schema {
+	eventDataTable := fs.String("event_data_table", "CustomerEventData", "Table des événements (EventID, CustomerID, EventTypeID, EventDate, Quantity, Digest)")
+	eventTable := fs.String("event_table", "CustomerEvent", "Table des dates d'insertion (EventID, InsertDate)")
+	purchaseType := fs.Int("purchase_event_type", 6, "EventTypeID des achats")
+	pricePath := fs.String("price_path", "$.price.originalUnitPrice", "Chemin JSON du prix unitaire dans Digest")
+	currencyPath := fs.String("currency_path", "$.price.currency", "Chemin JSON de la devise dans Digest (avec -currency)")
+	return func() models.Schema {
+		return models.Schema{
+			EventDataTable:      *eventDataTable,
+			EventTable:          *eventTable,
+			PurchaseEventTypeID: *purchaseType,
+			PricePath:           *pricePath,
+			CurrencyPath:        *currencyPath,
+		}
+	}
+}
+
+// calcFlags déclare sur fs les flags de calcul communs au calcul one-shot, à `reconcile` et à `serve`
+// (chargement, remboursements, arrondi, granularité, segments et mapping de schéma) et renvoie une fonction
+// qui, une fois fs.Parse appelé, les valide et construit le models.Config correspondant.
+func calcFlags(fs *flag.FlagSet) func() (models.Config, error) {
+	chunkSize := fs.Int("chunk_size", 1000, "IDs per IN (...) query")
+	loadWorkers := fs.Int("load_workers", 1, "Concurrent chunk queries")
+	partitions := fs.Int("partitions", 1, "CustomerID ranges of full-scan loads, queried on -load_workers connections")
+	granularity := fs.String("granularity", "month", "Cohort granularity: day, week, month, quarter, year")
+	segmentBy := fs.String("segment_by", "", "Digest JSON paths of the first purchase used to segment cohorts (ex: $.channel,$.country)")
+	refundTypes := fs.String("refund_event_types", "", "Refund/cancellation EventTypeIDs subtracted for net LTV (ex: 7,8)")
+	roundingName := fs.String("rounding", string(models.RoundHalfEven), "Money rounding: half_even or half_up")
+	schema := schemaFlags(fs)
+	return func() (models.Config, error) {
+		refundTypeIDs, err := parseIntList(*refundTypes)
+		if err != nil {
+			return models.Config{}, fmt.Errorf("refund_event_types: %w", err)
+		}
+		rounding, err := models.ParseRoundingMode(*roundingName)
+		if err != nil {
+			return models.Config{}, fmt.Errorf("rounding: %w", err)
+		}
+		if _, err := calculator.ParseGranularity(*granularity); err != nil {
+			return models.Config{}, err
+		}
+		segmentPaths := parseStringList(*segmentBy)
+		if err := database.CheckSegmentPaths(segmentPaths); err != nil {
+			return models.Config{}, err
+		}
+		return models.Config{
+			ChunkSize:          *chunkSize,
+			LoadWorkers:        *loadWorkers,
+			Partitions:         *partitions,
+			RefundEventTypeIDs: refundTypeIDs,
+			Schema:             schema(),
+			Granularity:        *granularity,
+			SegmentBy:          segmentPaths,
+			Rounding:           rounding,
+		}, nil
+	}
+}
+
+// currencyFlags déclare sur fs les flags de conversion de devises et renvoie une fonction qui,
+// une fois fs.Parse appelé, charge la table de taux (CSV local ou table de la base, db nil sans -dsn).
+// Sans -currency, elle renvoie nil : les montants sont additionnés sans conversion.
+func currencyFlags(fs *flag.FlagSet) func(ctx context.Context, db *sql.DB) (models.CurrencyConverter, error) {
+	reporting := fs.String("currency", "", "Devise de reporting (ex: EUR) ; active la conversion avec -fx_rates ou -fx_table")
+	ratesPath := fs.String("fx_rates", "", "Fichier CSV des taux (date,currency,rate)")
+	ratesTable := fs.String("fx_table", "", "Table des taux (RateDate, Currency, Rate)")
+	return func(ctx context.Context, db *sql.DB) (models.CurrencyConverter, error) {
+		if *reporting == "" {
+			if *ratesPath != "" || *ratesTable != "" {
+				return nil, fmt.Errorf("currency: -fx_rates/-fx_table nécessitent -currency")
+			}
+			return nil, nil
+		}
+		var (
+			t   *fx.Table
+			err error
+		)
+		switch {
+		case *ratesPath != "" && *ratesTable != "":
+			return nil, fmt.Errorf("currency: -fx_rates et -fx_table sont exclusifs")
+		case *ratesPath != "":
+			t, err = fx.LoadCSV(*ratesPath, *reporting)
+		case *ratesTable != "" && db == nil:
+			return nil, fmt.Errorf("currency: -fx_table nécessite -dsn")
+		case *ratesTable != "":
+			t, err = database.LoadFXRates(ctx, db, *ratesTable, *reporting)
+		default:
+			// uniquement la devise de reporting : les autres devises sont comptées à part
+			t, err = fx.NewTable(*reporting)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return t, nil
+	}
+}
+
+// openSource ouvre la source des événements : l'extrait local si source est renseigné (file://...),
+// sinon la base dsn, dont le schéma est alors validé contre le catalogue. La base est aussi
+// ouverte avec un extrait si dsn est fourni (taux, état, -sink=db) ; db est nil sinon.
+func openSource(ctx context.Context, dsn, source string, sch models.Schema, verbose bool) (calculator.EventSource, *sql.DB, error) {
+	var db *sql.DB
+	if dsn != "" {
+		var (
+			dsnUsed string
+			err     error
+		)
+		if db, dsnUsed, err = database.Open(dsn); err != nil {
+			return nil, nil, fmt.Errorf("open db: %w", err)
+		}
+		if verbose {
+			log.Printf("[INFO] connected dsn=%s", dsnUsed)
+		}
+	}
+	if source == "" {
+		if err := database.ValidateSchema(ctx, db, sch); err != nil {
+			db.Close()
+			return nil, nil, err
+		}
+		return database.NewSQLSource(db), db, nil
+	}
+
+	fail := func(err error) (calculator.EventSource, *sql.DB, error) {
+		if db != nil {
+			db.Close()
+		}
+		return nil, nil, err
+	}
+	if !filesource.IsFileURI(source) {
+		return fail(fmt.Errorf("source: %q inconnue (attendu: file://events.parquet, .csv ou .jsonl)", source))
+	}
+	if err := database.CheckSchema(database.ResolveSchema(sch)); err != nil {
+		return fail(err)
+	}
+	src, err := filesource.Open(source)
+	if err != nil {
+		return fail(err)
+	}
+	if verbose {
+		log.Printf("[INFO] source=%s", src.Path)
+	}
+	return src, db, nil
+}
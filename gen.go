@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"ltv-monthly/pkg/calculator"
+	"ltv-monthly/pkg/database"
+	"ltv-monthly/pkg/gen"
+	"ltv-monthly/pkg/models"
+)
+
+// runGen implémente la sous-commande `ltv-monthly gen` : génère des clients et des événements d'achat
+// synthétiques (déterministes pour une graine) en INSERT SQL, en CSV ou directement dans une base.
+func runGen(args []string) {
+	fs := flag.NewFlagSet("gen", flag.ExitOnError)
+	seed := fs.Int64("seed", 1, "Random seed (same seed and flags, same events)")
+	customers := fs.Int("customers", 1000, "Number of acquired customers")
+	startMonth := fs.String("start_month", "", "First acquisition month (MMYYYY) ou date (YYYY-MM-DD)")
+	months := fs.Int("months", 12, "Number of acquisition months")
+	until := fs.String("until", "", "Exclusive end of events (MMYYYY, YYYY-MM-DD ou RFC3339), défaut: start_month + months + 12 mois")
+	growth := fs.Float64("growth", 0.03, "Monthly growth of acquisitions (0.03 = +3%/month)")
+	seasonality := fs.Float64("seasonality", 0.2, "Amplitude of the yearly acquisition seasonality, in [0, 1)")
+	churn := fs.Float64("churn", 0.15, "Monthly churn probability after the acquisition month")
+	ordersPerMonth := fs.Float64("orders_per_month", 0.4, "Mean repeat orders per active month (Poisson)")
+	orderValue := fs.Float64("order_value", 45, "Mean unit price (lognormal)")
+	orderSigma := fs.Float64("order_sigma", 0.6, "Standard deviation of the log unit price")
+	refundRate := fs.Float64("refund_rate", 0.03, "Share of refunded orders")
+	refundType := fs.Int("refund_type", 7, "EventTypeID of refunds")
+	insertSkew := fs.Duration("insert_skew", 0, "Mean delay between EventDate and CustomerEvent.InsertDate (ex: 36h, 0 = immediate)")
+	channels := fs.String("channels", "web,store,app", "Values of $.channel in Digest (empty = absent)")
+	countries := fs.String("countries", "FR,DE,ES,IT", "Values of $.country in Digest (empty = absent)")
+	currencyCode := fs.String("currency", "", "Currency written at -currency_path (empty = absent)")
+	formatName := fs.String("format", "sql", "Output: sql (INSERT statements), csv (readable by -source) or db (inserted into -dsn)")
+	outPath := fs.String("o", "", "Output file for sql/csv (default: stdout)")
+	dsn := fs.String("dsn", os.Getenv("LTV_MONTHLY_DSN"), "DSN MariaDB/MySQL, PostgreSQL or SQLite for -format=db (tables created if missing)")
+	batch := fs.Int("batch", 500, "Events per INSERT statement")
+	verbose := fs.Bool("v", true, "Mode verbeux")
+	schema := schemaFlags(fs)
+	fs.Parse(args)
+
+	if *startMonth == "" {
+		log.Fatalf("Usage: ltv-monthly gen --start_month MMYYYY [--months 12] [--customers 1000] [--format sql|csv|db] [--o events.sql]")
+	}
+	start, err := calculator.ParseObservation(*startMonth)
+	if err != nil {
+		log.Fatalf("[ERROR] start_month: %v", err)
+	}
+	var end time.Time
+	if *until != "" {
+		if end, err = calculator.ParseObservation(*until); err != nil {
+			log.Fatalf("[ERROR] until: %v", err)
+		}
+	}
+	if err := database.CheckSchema(schema()); err != nil {
+		log.Fatalf("[ERROR] %v", err)
+	}
+	if *batch <= 0 {
+		log.Fatalf("[ERROR] batch: valeur positive attendue")
+	}
+
+	p := gen.Params{
+		Seed:           *seed,
+		Customers:      *customers,
+		Start:          start,
+		Months:         *months,
+		Until:          end,
+		Growth:         *growth,
+		Seasonality:    *seasonality,
+		Churn:          *churn,
+		OrdersPerMonth: *ordersPerMonth,
+		OrderValue:     *orderValue,
+		OrderSigma:     *orderSigma,
+		RefundRate:     *refundRate,
+		RefundTypeID:   *refundType,
+		InsertSkew:     *insertSkew,
+		Channels:       parseStringList(*channels),
+		Countries:      parseStringList(*countries),
+		Currency:       *currencyCode,
+		Schema:         schema(),
+	}
+
+	var stats gen.Stats
+	switch *formatName {
+	case "sql", "csv":
+		err = writeOutput(*outPath, func(w io.Writer) error {
+			var out interface {
+				Write(models.EventRecord) error
+				Flush() error
+			}
+			if *formatName == "csv" {
+				out = gen.NewCSVWriter(w)
+			} else {
+				out = gen.NewSQLWriter(w, database.ResolveSchema(p.Schema), *batch)
+			}
+			var err error
+			if stats, err = gen.Generate(p, out.Write); err != nil {
+				return err
+			}
+			return out.Flush()
+		})
+	case "db":
+		if *dsn == "" {
+			log.Fatalf("[ERROR] -format=db nécessite -dsn")
+		}
+		stats, err = genToDB(context.Background(), *dsn, p, *batch, *verbose)
+	default:
+		log.Fatalf("[ERROR] format: attendu sql, csv ou db, reçu %q", *formatName)
+	}
+	if err != nil {
+		log.Fatalf("[ERROR] gen: %v", err)
+	}
+	if *verbose {
+		log.Printf("[INFO] generated customers=%d orders=%d refunds=%d revenue=%s",
+			stats.Customers, stats.Orders, stats.Refunds, stats.Revenue.StringFixed(2))
+	}
+}
+
+// genToDB insère les événements générés dans la base dsn, par lots de batch événements,
+// après avoir créé les tables d'événements du mapping si elles n'existent pas.
+func genToDB(ctx context.Context, dsn string, p gen.Params, batch int, verbose bool) (gen.Stats, error) {
+	db, dsnUsed, err := database.Open(dsn)
+	if err != nil {
+		return gen.Stats{}, err
+	}
+	defer db.Close()
+	if verbose {
+		log.Printf("[INFO] connected dsn=%s", dsnUsed)
+	}
+	if err := database.EnsureEventTables(ctx, db, p.Schema); err != nil {
+		return gen.Stats{}, err
+	}
+
+	pending := make([]models.EventRecord, 0, batch)
+	stats, err := gen.Generate(p, func(e models.EventRecord) error {
+		if pending = append(pending, e); len(pending) < batch {
+			return nil
+		}
+		err := database.InsertEvents(ctx, db, p.Schema, pending)
+		pending = pending[:0]
+		return err
+	})
+	if err != nil {
+		return stats, err
+	}
+	return stats, database.InsertEvents(ctx, db, p.Schema, pending)
+}
@@ -0,0 +1,272 @@
+package calculator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"ltv-monthly/pkg/models"
+	"ltv-monthly/pkg/parallel"
+)
+
+// customerAgg contient les agrégats d'un client, mis à jour événement par événement.
+type customerAgg struct {
+	First   time.Time    // date de la première commande
+	Revenue models.Money // somme exacte UnitPrice*Quantity des événements "pricing"
+	Events  int          // nombre d'événements "pricing"
+	Refunds models.Money // somme exacte (positive) des remboursements/annulations
+
+	// Unconverted : événements exclus des montants faute de taux pour leur devise (Config.Currency).
+	Unconverted int
+
+	// Segments : valeurs de Config.SegmentBy lues sur la première commande.
+	Segments     []string
+	firstEventID uint64
+
+	// RevenueByPeriod : revenu par période (Granularity.index), renseigné uniquement si tracking.periods.
+	RevenueByPeriod map[int]models.Money
+	// RevenueByDay : revenu par jour d'achat (jours depuis l'epoch), renseigné uniquement si tracking.days.
+	RevenueByDay map[int]models.Money
+	// Predicted : revenu futur prédit par horizon de Config.PredictHorizons.
+	Predicted []models.Money
+}
+
+// tracking liste les détails optionnels conservés par client, au prix de mémoire supplémentaire.
+type tracking struct {
+	periods bool // revenu par période de cohorte (triangle)
+	days    bool // revenu par jour d'achat (prédiction BG/NBD)
+}
+
+// aggregator agrège les événements au fil de l'eau : la mémoire est proportionnelle
+// au nombre de clients, pas au nombre d'événements.
+type aggregator struct {
+	customers       map[uint64]*customerAgg
+	refundTypes     map[int]struct{}
+	granularity     Granularity
+	track           tracking
+	eventsRead      int
+	eventsWithPrice int
+	refundEvents    int
+
+	currency    models.CurrencyConverter
+	rounding    models.RoundingMode
+	unconverted map[string]int // devise → événements non convertis
+}
+
+func newAggregator(cfg models.Config, track tracking) *aggregator {
+	refundTypes := make(map[int]struct{}, len(cfg.RefundEventTypeIDs))
+	for _, id := range cfg.RefundEventTypeIDs {
+		refundTypes[id] = struct{}{}
+	}
+	return &aggregator{
+		customers:   make(map[uint64]*customerAgg, 1024),
+		refundTypes: refundTypes,
+		granularity: Granularity(cfg.Granularity),
+		track:       track,
+		currency:    cfg.Currency,
+		rounding:    cfg.Rounding,
+		unconverted: make(map[string]int),
+	}
+}
+
+// add intègre un événement dans les agrégats de son client ; erreur si son montant dépasse la capacité de Money.
+func (a *aggregator) add(ev models.RawEventData) error {
+	a.eventsRead++
+	c, ok := a.customers[ev.CustomerID]
+	if !ok {
+		c = &customerAgg{}
+		a.customers[ev.CustomerID] = c
+	}
+	// remboursements : soustraits du revenu net, sans effet sur la date de première commande
+	if _, refund := a.refundTypes[ev.EventTypeID]; refund {
+		if ev.UnitPrice != 0 && ev.Quantity > 0 {
+			total, err := ev.UnitPrice.Mul(ev.Quantity)
+			if err != nil {
+				return fmt.Errorf("event %d: %w", ev.EventID, err)
+			}
+			amount, ok, err := a.convert(total, ev)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				c.Unconverted++
+				return nil
+			}
+			c.Refunds += amount.Abs()
+			a.refundEvents++
+		}
+		return nil
+	}
+	// min première date (à date égale, le plus petit EventID, pour des segments déterministes)
+	if c.First.IsZero() || ev.EventDate.Before(c.First) || (ev.EventDate.Equal(c.First) && ev.EventID < c.firstEventID) {
+		c.First = ev.EventDate
+		c.firstEventID = ev.EventID
+		c.Segments = ev.Segments
+	}
+	// revenus + nombre d'événements "pricing"
+	if ev.UnitPrice > 0 && ev.Quantity > 0 {
+		total, err := ev.UnitPrice.Mul(ev.Quantity)
+		if err != nil {
+			return fmt.Errorf("event %d: %w", ev.EventID, err)
+		}
+		amount, ok, err := a.convert(total, ev)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			c.Unconverted++
+			return nil
+		}
+		c.Revenue += amount
+		c.Events++
+		a.eventsWithPrice++
+		if a.track.periods {
+			if c.RevenueByPeriod == nil {
+				c.RevenueByPeriod = make(map[int]models.Money, 4)
+			}
+			c.RevenueByPeriod[a.granularity.index(ev.EventDate)] += amount
+		}
+		if a.track.days {
+			if c.RevenueByDay == nil {
+				c.RevenueByDay = make(map[int]models.Money, 4)
+			}
+			c.RevenueByDay[dayIndex(ev.EventDate)] += amount
+		}
+	}
+	return nil
+}
+
+// convert ramène amount dans la devise de reporting ; ok = false (événement compté à part)
+// si la devise de ev est absente, inconnue ou sans taux à sa date.
+func (a *aggregator) convert(amount models.Money, ev models.RawEventData) (models.Money, bool, error) {
+	if a.currency == nil {
+		return amount, true, nil
+	}
+	v, ok, err := a.currency.Convert(amount, ev.Currency, ev.EventDate, a.rounding)
+	if err != nil {
+		return 0, false, fmt.Errorf("event %d: %w", ev.EventID, err)
+	}
+	if !ok {
+		a.unconverted[ev.Currency]++
+	}
+	return v, ok, nil
+}
+
+// logUnconverted signale les événements exclus des montants, par devise.
+func (a *aggregator) logUnconverted() {
+	if len(a.unconverted) == 0 {
+		return
+	}
+	total := 0
+	parts := make([]string, 0, len(a.unconverted))
+	for cur, n := range a.unconverted {
+		total += n
+		if cur == "" {
+			cur = "(absente)"
+		}
+		parts = append(parts, fmt.Sprintf("%s=%d", cur, n))
+	}
+	sort.Strings(parts)
+	log.Printf("[WARN] %d événement(s) non converti(s) dans la devise de reporting, exclus des montants : %s",
+		total, strings.Join(parts, ", "))
+}
+
+// aggregateEvents alimente un aggregator depuis src. Sans InsertDate, les événements
+// sont consommés en flux, par plages de CustomerID parallèles si la source le permet (Config.Partitions) ;
+// avec InsertDate, en flux déjà ré-datés si la source implémente InsertDateStreamer, sinon chargés pour être ré-datés.
+func aggregateEvents(ctx context.Context, src EventSource, cfg models.Config, useInsertDate bool, track tracking) (*aggregator, error) {
+	agg := newAggregator(cfg, track)
+	if is, ok := src.(InsertDateStreamer); ok && useInsertDate {
+		err := is.StreamOrderEventsWithInsertDate(ctx, cfg.Observation, cfg, agg.add)
+		if err != nil {
+			return nil, err
+		}
+		return agg, nil
+	}
+	if useInsertDate {
+		events, err := loadEvents(ctx, src, cfg, true)
+		if err != nil {
+			return nil, err
+		}
+		for _, ev := range events {
+			if err := agg.add(ev); err != nil {
+				return nil, err
+			}
+		}
+		return agg, nil
+	}
+
+	if ps, ok := src.(PartitionedSource); ok && cfg.Partitions > 1 {
+		return aggregatePartitioned(ctx, ps, cfg, track)
+	}
+	err := src.StreamOrderEvents(ctx, cfg.Observation, cfg, agg.add)
+	if err != nil {
+		return nil, err
+	}
+	return agg, nil
+}
+
+// aggregatePartitioned agrège chaque plage de CustomerID de src dans son propre aggregator, sur au plus
+// cfg.LoadWorkers goroutines, puis fusionne les résultats : les plages sont disjointes, chaque client
+// n'est donc vu que par un seul aggregator.
+func aggregatePartitioned(ctx context.Context, src PartitionedSource, cfg models.Config, track tracking) (*aggregator, error) {
+	ranges, err := src.CustomerRanges(ctx, cfg.Partitions, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("customer ranges: %w", err)
+	}
+	workers := min(max(cfg.LoadWorkers, 1), max(len(ranges), 1))
+
+	parts := make([]*aggregator, len(ranges))
+	err = parallel.ForEach(ctx, len(ranges), workers, func(ctx context.Context, i int) error {
+		start := time.Now()
+		part := newAggregator(cfg, track)
+		err := src.StreamOrderEventsInRange(ctx, ranges[i], cfg.Observation, cfg, part.add)
+		if err != nil {
+			return err
+		}
+		parts[i] = part
+		if cfg.Verbose {
+			log.Printf("[INFO] [LOAD] partition %d/%d CustomerID [%d, %d]: events=%d, customers=%d in %s",
+				i+1, len(ranges), ranges[i].From, ranges[i].To, part.eventsRead, len(part.customers), time.Since(start))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	agg := newAggregator(cfg, track)
+	for _, part := range parts {
+		agg.merge(part)
+	}
+	if cfg.Verbose {
+		log.Printf("[INFO] [LOAD] events: %d (%d partitions, %d workers)", agg.eventsRead, len(ranges), workers)
+	}
+	return agg, nil
+}
+
+// merge intègre les agrégats de b, dont les clients sont absents de a.
+func (a *aggregator) merge(b *aggregator) {
+	for id, c := range b.customers {
+		a.customers[id] = c
+	}
+	a.eventsRead += b.eventsRead
+	a.eventsWithPrice += b.eventsWithPrice
+	a.refundEvents += b.refundEvents
+	for cur, n := range b.unconverted {
+		a.unconverted[cur] += n
+	}
+}
+
+// dayIndex renvoie le nombre de jours UTC depuis l'epoch.
+func dayIndex(t time.Time) int {
+	return int(t.UTC().Unix() / 86400)
+}
+
+// monthIndex renvoie un index de mois calendaire (année*12+mois) pour comparer/soustraire des mois.
+func monthIndex(t time.Time) int {
+	return t.Year()*12 + int(t.Month()) - 1
+}
@@ -0,0 +1,52 @@
+package calculator
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"slices"
+
+	"ltv-monthly/pkg/models"
+)
+
+// defaultConfidence est le niveau de confiance utilisé quand Bootstrap.Confidence n'est pas renseigné.
+const defaultConfidence = 0.95
+
+// bootstrapCI estime l'intervalle de confiance de la moyenne des revenus par client d'une cohorte,
+// par la méthode des percentiles sur cfg.Bootstrap.Iterations rééchantillonnages avec remise.
+// key identifie la cohorte (période et segment) : le tirage ne dépend que de la graine et de la cohorte,
+// pas des autres cohortes calculées ni de l'ordre de chargement des clients. nil si désactivé ou sans client.
+func bootstrapCI(revenues []models.Money, key string, cfg models.Config) *models.Interval {
+	b := cfg.Bootstrap
+	n := len(revenues)
+	if b.Iterations <= 0 || n == 0 {
+		return nil
+	}
+	level := b.Confidence
+	if level <= 0 || level >= 1 {
+		level = defaultConfidence
+	}
+
+	sorted := slices.Clone(revenues)
+	slices.Sort(sorted)
+
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	rng := rand.New(rand.NewSource(b.Seed ^ int64(h.Sum64())))
+
+	means := make([]models.Money, b.Iterations)
+	for i := range means {
+		var sum models.Money
+		for j := 0; j < n; j++ {
+			sum += sorted[rng.Intn(n)]
+		}
+		means[i] = sum.Div(n, cfg.Rounding)
+	}
+	slices.Sort(means)
+
+	alpha := (1 - level) / 2
+	return &models.Interval{
+		Low:   percentile(means, alpha, cfg.Rounding),
+		High:  percentile(means, 1-alpha, cfg.Rounding),
+		Level: level,
+	}
+}
@@ -0,0 +1,60 @@
+package calculator
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"ltv-monthly/pkg/models"
+)
+
+func TestBootstrapCI(t *testing.T) {
+	cfg := models.Config{Rounding: models.RoundHalfEven, Bootstrap: models.Bootstrap{Iterations: 2000, Seed: 7}}
+	revenues := eurs(0, 5, 10, 10, 20, 25, 40, 60, 80, 150)
+	mean := eur(40)
+
+	ci := bootstrapCI(revenues, "01/2025", cfg)
+	if ci == nil || ci.Level != 0.95 || ci.Low >= mean || ci.High <= mean || ci.Low < 0 {
+		t.Fatalf("unexpected interval around %s: %+v", mean, ci)
+	}
+
+	// reproductible : même graine et même cohorte, quel que soit l'ordre des clients
+	shuffled := eurs(150, 80, 60, 40, 25, 20, 10, 10, 5, 0)
+	if again := bootstrapCI(shuffled, "01/2025", cfg); !reflect.DeepEqual(ci, again) {
+		t.Fatalf("not reproducible: %+v vs %+v", ci, again)
+	}
+
+	// un niveau plus élevé élargit l'intervalle
+	cfg.Bootstrap.Confidence = 0.99
+	wide := bootstrapCI(revenues, "01/2025", cfg)
+	if wide.Low > ci.Low || wide.High < ci.High {
+		t.Fatalf("99%% interval %+v narrower than 95%% %+v", wide, ci)
+	}
+
+	if bootstrapCI(nil, "01/2025", cfg) != nil {
+		t.Fatal("expected nil interval without customers")
+	}
+	cfg.Bootstrap.Iterations = 0
+	if bootstrapCI(revenues, "01/2025", cfg) != nil {
+		t.Fatal("expected nil interval when disabled")
+	}
+}
+
+func TestRun_BootstrapMatchesAcrossRunners(t *testing.T) {
+	cfg := fixtureConfig()
+	cfg.Bootstrap = models.Bootstrap{Iterations: 200, Confidence: 0.9, Seed: 42}
+	var prev []models.CohortResult
+	for _, runner := range []Runner{Run, RunRamOptimized, Run} {
+		got, err := runner(context.Background(), fixtureSource(), cfg)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got[0].LTVCI == nil || got[0].LTVCI.Low < eur(20) || got[0].LTVCI.High > eur(30) {
+			t.Fatalf("unexpected 01/2025 interval: %+v", got[0].LTVCI)
+		}
+		if prev != nil && !reflect.DeepEqual(prev, got) {
+			t.Fatalf("runs disagree:\n%+v\n%+v", prev, got)
+		}
+		prev = got
+	}
+}
@@ -0,0 +1,258 @@
+package calculator
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"ltv-monthly/pkg/models"
+)
+
+// cohortBucket cumule les agrégats des clients d'une cohorte (période × segment).
+type cohortBucket struct {
+	segments []string
+	clients  int
+	total    models.Money
+	refunds  models.Money
+	events   int
+
+	unconverted int
+	predicted   []models.Money // revenu futur prédit cumulé, par horizon
+
+	// rétention (projection.retention) : clients actifs par âge, commandes, clients réacheteurs
+	active    []int
+	orders    int
+	repeaters int
+
+	revenues []models.Money // revenu brut par client (projection.keepRevenues)
+}
+
+// projection répartit les clients agrégés dans leurs cohortes, puis construit les résultats.
+// Elle est partagée par runCore et RunRamOptimized pour garantir des résultats identiques.
+type projection struct {
+	g            Granularity
+	retention    bool                                // calcule la rétention depuis customerAgg.RevenueByDay
+	keepRevenues bool                                // conserve le revenu de chaque client (distribution, bootstrap)
+	byPeriod     map[string]map[string]*cohortBucket // libellé de période → clé de segment → bucket
+}
+
+// newProjection prépare la projection de periods périodes ; cfg indique les métriques optionnelles.
+func newProjection(g Granularity, periods int, cfg models.Config) *projection {
+	return &projection{
+		g:            g,
+		retention:    cfg.Retention,
+		keepRevenues: cfg.Distribution || cfg.Bootstrap.Iterations > 0,
+		byPeriod:     make(map[string]map[string]*cohortBucket, periods),
+	}
+}
+
+// add affecte un client, dont la première commande date de first, à sa cohorte.
+// c peut être nil (client sans événement "pricing" chargé) : il compte alors pour 0.
+func (p *projection) add(first time.Time, c *customerAgg) {
+	key := p.g.label(first)
+	var segments []string
+	if c != nil {
+		segments = c.Segments
+	}
+	segKey := strings.Join(segments, "\x00")
+
+	bySegment := p.byPeriod[key]
+	if bySegment == nil {
+		bySegment = make(map[string]*cohortBucket, 1)
+		p.byPeriod[key] = bySegment
+	}
+	b := bySegment[segKey]
+	if b == nil {
+		b = &cohortBucket{segments: segments}
+		bySegment[segKey] = b
+	}
+	b.clients++
+	if p.keepRevenues {
+		var revenue models.Money
+		if c != nil {
+			revenue = c.Revenue
+		}
+		b.revenues = append(b.revenues, revenue)
+	}
+	if c != nil {
+		b.total += c.Revenue
+		b.refunds += c.Refunds
+		b.events += c.Events
+		b.unconverted += c.Unconverted
+		if len(c.Predicted) > 0 && b.predicted == nil {
+			b.predicted = make([]models.Money, len(c.Predicted))
+		}
+		for i, v := range c.Predicted {
+			b.predicted[i] += v
+		}
+		if p.retention {
+			p.addActivity(b, first, c)
+		}
+	}
+}
+
+// addAggregate cumule les sommes d'une période de cohorte déjà agrégées par la source (mode pushdown).
+func (p *projection) addAggregate(a models.CohortAggregate) {
+	key := p.g.label(a.PeriodStart)
+	bySegment := p.byPeriod[key]
+	if bySegment == nil {
+		bySegment = make(map[string]*cohortBucket, 1)
+		p.byPeriod[key] = bySegment
+	}
+	b := bySegment[""]
+	if b == nil {
+		b = &cohortBucket{}
+		bySegment[""] = b
+	}
+	b.clients += a.Clients
+	b.total += a.Revenue
+	b.refunds += a.Refunds
+	b.events += a.Events
+}
+
+// results construit une ligne par (période, segment) dans l'ordre des périodes demandées,
+// segments triés ; une période sans client donne une ligne à zéro.
+func (p *projection) results(periods []time.Time, cfg models.Config) []models.CohortResult {
+	results := make([]models.CohortResult, 0, len(periods))
+	for _, start := range periods {
+		key := p.g.label(start)
+		bySegment := p.byPeriod[key]
+
+		segKeys := make([]string, 0, len(bySegment))
+		for k := range bySegment {
+			segKeys = append(segKeys, k)
+		}
+		sort.Strings(segKeys)
+		if len(segKeys) == 0 {
+			segKeys = append(segKeys, "")
+		}
+
+		for _, sk := range segKeys {
+			b := bySegment[sk]
+			if b == nil {
+				b = &cohortBucket{}
+			}
+
+			var dist *models.Distribution
+			if cfg.Distribution {
+				dist = distributionOf(b.revenues, cfg)
+			}
+
+			// sommes exactes, une seule division arrondie par moyenne
+			ltv := b.total.Div(b.clients, cfg.Rounding)
+			refunds := b.refunds.Div(b.clients, cfg.Rounding)
+			net := (b.total - b.refunds).Div(b.clients, cfg.Rounding)
+
+			results = append(results, models.CohortResult{
+				MonthYear:     key,
+				PeriodStart:   start,
+				Segments:      segmentMap(cfg.SegmentBy, b.segments),
+				LTVAvg:        ltv,
+				CohortClients: b.clients,
+				EventsRead:    b.events, // priced events used in revenue
+				RefundsAvg:    refunds,
+				NetLTVAvg:     net,
+
+				UnconvertedEvents: b.unconverted,
+				Predicted:         predictedLTV(cfg, b),
+				Retention:         p.retentionOf(b, start, cfg),
+				Distribution:      dist,
+				LTVCI:             bootstrapCI(b.revenues, key+"\x00"+sk, cfg),
+			})
+
+			if cfg.Verbose {
+				log.Printf("[INFO] %s%s -> LTV=%s | clients=%d | events=%d",
+					key, segmentSuffix(b.segments), ltv, b.clients, b.events)
+			}
+		}
+	}
+	return results
+}
+
+// addActivity cumule les commandes du client c et les âges (périodes depuis first) auxquels il a acheté.
+func (p *projection) addActivity(b *cohortBucket, first time.Time, c *customerAgg) {
+	orders := len(c.RevenueByDay)
+	b.orders += orders
+	if orders >= 2 {
+		b.repeaters++
+	}
+	firstIndex := p.g.index(first)
+	seen := make(map[int]struct{}, orders)
+	for d := range c.RevenueByDay {
+		age := p.g.index(time.Unix(int64(d)*86400, 0).UTC()) - firstIndex
+		if _, ok := seen[age]; ok || age < 0 {
+			continue
+		}
+		seen[age] = struct{}{}
+		for len(b.active) <= age {
+			b.active = append(b.active, 0)
+		}
+		b.active[age]++
+	}
+}
+
+// retentionOf construit les métriques de rétention du bucket d'une cohorte débutant à start ; nil si non demandées.
+func (p *projection) retentionOf(b *cohortBucket, start time.Time, cfg models.Config) *models.Retention {
+	if !p.retention {
+		return nil
+	}
+	ages := p.g.ages(start, cfg.Observation)
+	r := &models.Retention{
+		ActiveCustomers: make([]int, ages),
+		RetentionRate:   make([]float64, ages),
+		AvgOrderValue:   b.total.Div(b.orders, cfg.Rounding),
+	}
+	for k := 0; k < ages; k++ {
+		if k < len(b.active) {
+			r.ActiveCustomers[k] = b.active[k]
+		}
+		if b.clients > 0 {
+			r.RetentionRate[k] = float64(r.ActiveCustomers[k]) / float64(b.clients)
+		}
+	}
+	if b.clients > 0 {
+		r.RepeatPurchaseRate = float64(b.repeaters) / float64(b.clients)
+		r.AvgOrders = float64(b.orders) / float64(b.clients)
+	}
+	return r
+}
+
+// predictedLTV renvoie la LTV moyenne attendue par horizon : (revenu historique + revenu futur prédit) / clients.
+func predictedLTV(cfg models.Config, b *cohortBucket) []models.PredictedLTV {
+	if len(cfg.PredictHorizons) == 0 {
+		return nil
+	}
+	out := make([]models.PredictedLTV, len(cfg.PredictHorizons))
+	for i, h := range cfg.PredictHorizons {
+		total := b.total
+		if i < len(b.predicted) {
+			total += b.predicted[i]
+		}
+		out[i] = models.PredictedLTV{Months: h, LTVAvg: total.Div(b.clients, cfg.Rounding)}
+	}
+	return out
+}
+
+// segmentMap associe chaque chemin de -segment_by à sa valeur ; nil sans segmentation.
+func segmentMap(paths, values []string) map[string]string {
+	if len(paths) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(paths))
+	for i, p := range paths {
+		v := ""
+		if i < len(values) {
+			v = values[i]
+		}
+		m[p] = v
+	}
+	return m
+}
+
+func segmentSuffix(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return " [" + strings.Join(values, ", ") + "]"
+}
@@ -0,0 +1,118 @@
+package calculator
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+
+	"ltv-monthly/pkg/models"
+)
+
+// Traitements des valeurs extrêmes (models.OutlierPolicy.Method).
+const (
+	OutliersTrim      = "trim"      // les clients au-delà du seuil sont exclus de la moyenne
+	OutliersWinsorize = "winsorize" // les revenus au-delà du seuil sont ramenés au seuil
+)
+
+// ParseOutlierPolicy valide la politique saisie par l'utilisateur : "" (aucune),
+// "trim:0.99" ou "winsorize:0.95" (méthode et percentile haut).
+func ParseOutlierPolicy(s string) (models.OutlierPolicy, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return models.OutlierPolicy{}, nil
+	}
+	method, pct, ok := strings.Cut(s, ":")
+	if !ok || (method != OutliersTrim && method != OutliersWinsorize) {
+		return models.OutlierPolicy{}, fmt.Errorf("outliers: attendu trim:<p> ou winsorize:<p> (ex: trim:0.99), reçu %q", s)
+	}
+	p, err := strconv.ParseFloat(pct, 64)
+	if err != nil || p <= 0 || p >= 1 {
+		return models.OutlierPolicy{}, fmt.Errorf("outliers: percentile invalide %q (attendu dans ]0, 1[)", pct)
+	}
+	return models.OutlierPolicy{Method: method, Percentile: p}, nil
+}
+
+// distributionOf calcule la distribution des revenus par client d'une cohorte ; nil sans client.
+func distributionOf(revenues []models.Money, cfg models.Config) *models.Distribution {
+	n := len(revenues)
+	if n == 0 {
+		return nil
+	}
+	sorted := slices.Clone(revenues)
+	slices.Sort(sorted)
+
+	var total models.Money
+	for _, v := range sorted {
+		total += v
+	}
+	mean := total.Float64() / float64(n)
+	var sq float64
+	for _, v := range sorted {
+		d := v.Float64() - mean
+		sq += d * d
+	}
+
+	d := &models.Distribution{
+		Median:     percentile(sorted, 0.5, cfg.Rounding),
+		P25:        percentile(sorted, 0.25, cfg.Rounding),
+		P75:        percentile(sorted, 0.75, cfg.Rounding),
+		P90:        percentile(sorted, 0.90, cfg.Rounding),
+		P99:        percentile(sorted, 0.99, cfg.Rounding),
+		StdDev:     models.MoneyFromFloat(math.Sqrt(sq / float64(n))),
+		Top1Share:  topShare(sorted, total, 0.01),
+		Top10Share: topShare(sorted, total, 0.10),
+	}
+	if cfg.Outliers.Method != "" {
+		d.AdjustedAvg = adjustedMean(sorted, cfg.Outliers, cfg.Rounding)
+	}
+	return d
+}
+
+// percentile renvoie le percentile q de sorted (trié), par interpolation linéaire entre rangs.
+func percentile(sorted []models.Money, q float64, mode models.RoundingMode) models.Money {
+	pos := q * float64(len(sorted)-1)
+	lo := int(math.Floor(pos))
+	hi := min(lo+1, len(sorted)-1)
+	frac := pos - float64(lo)
+	if frac == 0 || sorted[hi] == sorted[lo] {
+		return sorted[lo]
+	}
+	// frac < 1 : le produit est borné par l'écart entre rangs, pas de dépassement possible
+	step, _ := (sorted[hi] - sorted[lo]).MulRat(new(big.Rat).SetFloat64(frac), mode)
+	return sorted[lo] + step
+}
+
+// topShare renvoie la part de total portée par la fraction share des meilleurs clients (au moins un).
+func topShare(sorted []models.Money, total models.Money, share float64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	k := max(1, int(math.Ceil(share*float64(len(sorted)))))
+	var top models.Money
+	for _, v := range sorted[len(sorted)-k:] {
+		top += v
+	}
+	return top.Float64() / total.Float64()
+}
+
+// adjustedMean renvoie la moyenne après exclusion (trim) ou plafonnement (winsorize)
+// des revenus supérieurs au percentile policy.Percentile.
+func adjustedMean(sorted []models.Money, policy models.OutlierPolicy, mode models.RoundingMode) models.Money {
+	threshold := percentile(sorted, policy.Percentile, mode)
+	var sum models.Money
+	kept := 0
+	for _, v := range sorted {
+		if v > threshold {
+			if policy.Method == OutliersTrim {
+				continue
+			}
+			v = threshold
+		}
+		sum += v
+		kept++
+	}
+	return sum.Div(kept, mode)
+}
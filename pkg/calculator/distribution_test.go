@@ -0,0 +1,81 @@
+package calculator
+
+import (
+	"context"
+	"testing"
+
+	"ltv-monthly/pkg/models"
+)
+
+func eurs(units ...int64) []models.Money {
+	out := make([]models.Money, len(units))
+	for i, u := range units {
+		out[i] = eur(u)
+	}
+	return out
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := eurs(0, 10, 20, 30, 40)
+	cases := map[float64]models.Money{0.25: eur(10), 0.5: eur(20), 0.9: eur(36), 0.99: models.MoneyFromFloat(39.6)}
+	for q, want := range cases {
+		if got := percentile(sorted, q, models.RoundHalfEven); got != want {
+			t.Fatalf("p%v: got %s, want %s", q, got, want)
+		}
+	}
+	if got := percentile(eurs(7), 0.9, models.RoundHalfEven); got != eur(7) {
+		t.Fatalf("single value: got %s", got)
+	}
+}
+
+func TestDistributionOf(t *testing.T) {
+	cfg := models.Config{Rounding: models.RoundHalfEven}
+	d := distributionOf(eurs(0, 0, 0, 0, 0, 0, 0, 0, 0, 100), cfg)
+	if d.Median != 0 || d.StdDev != eur(30) || d.Top1Share != 1 || d.Top10Share != 1 || d.AdjustedAvg != 0 {
+		t.Fatalf("unexpected distribution: %+v", d)
+	}
+	if distributionOf(nil, cfg) != nil {
+		t.Fatal("expected nil distribution without customers")
+	}
+
+	revenues := eurs(10, 20, 30, 40, 1000)
+	for _, tc := range []struct {
+		policy string
+		want   models.Money
+	}{
+		{"trim:0.75", eur(25)},      // 1000 exclu
+		{"winsorize:0.75", eur(28)}, // 1000 ramené à 40
+	} {
+		policy, err := ParseOutlierPolicy(tc.policy)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.policy, err)
+		}
+		cfg.Outliers = policy
+		if got := distributionOf(revenues, cfg).AdjustedAvg; got != tc.want {
+			t.Fatalf("%s: got %s, want %s", tc.policy, got, tc.want)
+		}
+	}
+}
+
+func TestParseOutlierPolicy_Errors(t *testing.T) {
+	for _, in := range []string{"trim", "cap:0.9", "trim:1", "winsorize:0", "trim:abc"} {
+		if _, err := ParseOutlierPolicy(in); err == nil {
+			t.Fatalf("%q: expected error, got nil", in)
+		}
+	}
+}
+
+func TestRun_Distribution(t *testing.T) {
+	cfg := fixtureConfig()
+	cfg.Distribution = true
+	for name, runner := range map[string]Runner{"Run": Run, "RunRamOptimized": RunRamOptimized} {
+		got, err := runner(context.Background(), fixtureSource(), cfg)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		jan := got[0].Distribution // revenus par client : 20 et 30
+		if jan == nil || jan.Median != eur(25) || jan.StdDev != eur(5) || jan.Top10Share != 0.6 {
+			t.Fatalf("%s: unexpected 01/2025 distribution: %+v", name, jan)
+		}
+	}
+}
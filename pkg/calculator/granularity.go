@@ -0,0 +1,124 @@
+package calculator
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Granularity est la taille des cohortes : les clients sont regroupés selon la période
+// (jour, semaine ISO, mois, trimestre, année) de leur première commande.
+type Granularity string
+
+const (
+	GranularityDay     Granularity = "day"
+	GranularityWeek    Granularity = "week" // semaine ISO 8601, du lundi au dimanche
+	GranularityMonth   Granularity = "month"
+	GranularityQuarter Granularity = "quarter"
+	GranularityYear    Granularity = "year"
+)
+
+// ParseGranularity valide le nom de granularité ("" = month).
+func ParseGranularity(s string) (Granularity, error) {
+	switch g := Granularity(strings.ToLower(strings.TrimSpace(s))); g {
+	case "":
+		return GranularityMonth, nil
+	case GranularityDay, GranularityWeek, GranularityMonth, GranularityQuarter, GranularityYear:
+		return g, nil
+	}
+	return "", fmt.Errorf("granularité inconnue %q (attendu: day, week, month, quarter, year)", s)
+}
+
+// Truncate renvoie le début (UTC) de la période contenant t.
+func (g Granularity) Truncate(t time.Time) time.Time {
+	t = t.UTC()
+	switch g {
+	case GranularityDay:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	case GranularityWeek:
+		d := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		offset := (int(d.Weekday()) + 6) % 7 // lundi = 0
+		return d.AddDate(0, 0, -offset)
+	case GranularityQuarter:
+		return time.Date(t.Year(), t.Month()-(t.Month()-1)%3, 1, 0, 0, 0, 0, time.UTC)
+	case GranularityYear:
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// next renvoie le début de la période suivant celle qui commence à start.
+func (g Granularity) next(start time.Time) time.Time {
+	switch g {
+	case GranularityDay:
+		return start.AddDate(0, 0, 1)
+	case GranularityWeek:
+		return start.AddDate(0, 0, 7)
+	case GranularityQuarter:
+		return start.AddDate(0, 3, 0)
+	case GranularityYear:
+		return start.AddDate(1, 0, 0)
+	default:
+		return start.AddDate(0, 1, 0)
+	}
+}
+
+// label renvoie le libellé de la période contenant t :
+// "DD/MM/YYYY", "YYYY-Www", "MM/YYYY", "Qn/YYYY" ou "YYYY".
+func (g Granularity) label(t time.Time) string {
+	t = g.Truncate(t)
+	switch g {
+	case GranularityDay:
+		return t.Format("02/01/2006")
+	case GranularityWeek:
+		y, w := t.ISOWeek()
+		return fmt.Sprintf("%04d-W%02d", y, w)
+	case GranularityQuarter:
+		return fmt.Sprintf("Q%d/%04d", (int(t.Month())-1)/3+1, t.Year())
+	case GranularityYear:
+		return fmt.Sprintf("%04d", t.Year())
+	default:
+		return formatMonth(t)
+	}
+}
+
+// index renvoie le rang de la période contenant t ; index(b)-index(a) est le nombre de périodes entre a et b.
+func (g Granularity) index(t time.Time) int {
+	t = g.Truncate(t)
+	switch g {
+	case GranularityDay:
+		return int(t.Unix() / 86400)
+	case GranularityWeek:
+		return int(t.Unix() / (7 * 86400))
+	case GranularityQuarter:
+		return monthIndex(t) / 3
+	case GranularityYear:
+		return t.Year()
+	default:
+		return monthIndex(t)
+	}
+}
+
+// ages renvoie le nombre d'âges (M0, M1, ...) atteints à obs par une cohorte débutant à start.
+func (g Granularity) ages(start, obs time.Time) int {
+	if !obs.After(start) {
+		return 0
+	}
+	return g.index(obs.Add(-time.Nanosecond)) - g.index(start) + 1
+}
+
+// periodsBetweenInclusive renvoie les débuts de période de start à end inclus.
+func (g Granularity) periodsBetweenInclusive(start, end time.Time) []time.Time {
+	if g == GranularityMonth {
+		return monthsBetweenInclusive(start, end)
+	}
+	cur := g.Truncate(start)
+	last := g.Truncate(end)
+	var out []time.Time
+	for !cur.After(last) {
+		out = append(out, cur)
+		cur = g.next(cur)
+	}
+	return out
+}
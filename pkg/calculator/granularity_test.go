@@ -0,0 +1,89 @@
+package calculator
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGranularity_TruncateAndLabel(t *testing.T) {
+	d := time.Date(2025, 1, 15, 13, 30, 0, 0, time.UTC) // mercredi, semaine ISO 3
+	cases := []struct {
+		g     Granularity
+		start time.Time
+		label string
+	}{
+		{GranularityDay, time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC), "15/01/2025"},
+		{GranularityWeek, time.Date(2025, 1, 13, 0, 0, 0, 0, time.UTC), "2025-W03"},
+		{GranularityMonth, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), "01/2025"},
+		{GranularityQuarter, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), "Q1/2025"},
+		{GranularityYear, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), "2025"},
+	}
+	for _, c := range cases {
+		if got := c.g.Truncate(d); !got.Equal(c.start) {
+			t.Fatalf("%s: truncate got %v, want %v", c.g, got, c.start)
+		}
+		if got := c.g.label(d); got != c.label {
+			t.Fatalf("%s: label got %q, want %q", c.g, got, c.label)
+		}
+	}
+	// la semaine ISO 1 de 2025 commence le lundi 30/12/2024
+	if got := GranularityWeek.label(time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC)); got != "2025-W01" {
+		t.Fatalf("got %q, want %q", got, "2025-W01")
+	}
+}
+
+func TestGranularity_Index(t *testing.T) {
+	a := time.Date(2024, 11, 20, 0, 0, 0, 0, time.UTC)
+	b := time.Date(2025, 2, 3, 0, 0, 0, 0, time.UTC)
+	if got := GranularityQuarter.index(b) - GranularityQuarter.index(a); got != 1 {
+		t.Fatalf("quarters between: got %d, want 1", got)
+	}
+	if got := GranularityWeek.index(b) - GranularityWeek.index(a); got != 11 {
+		t.Fatalf("weeks between: got %d, want 11", got)
+	}
+}
+
+func TestParseGranularity(t *testing.T) {
+	if g, err := ParseGranularity(""); err != nil || g != GranularityMonth {
+		t.Fatalf("got %q, %v; want month", g, err)
+	}
+	if _, err := ParseGranularity("fortnight"); err == nil {
+		t.Fatal("expected error for unknown granularity, got nil")
+	}
+}
+
+func TestRun_QuarterlyCohorts(t *testing.T) {
+	cfg := fixtureConfig()
+	cfg.Granularity = "quarter"
+	got, err := Run(context.Background(), fixtureSource(), cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// janvier et février tombent dans Q1 : 3 clients, 57 au total
+	if len(got) != 1 || got[0].MonthYear != "Q1/2025" || got[0].CohortClients != 3 || got[0].LTVAvg != eur(19) {
+		t.Fatalf("unexpected results: %+v", got)
+	}
+}
+
+func TestRunRamOptimized_WeeklyMatchesRun(t *testing.T) {
+	cfg := fixtureConfig()
+	cfg.Granularity = "week"
+	want, err := Run(context.Background(), fixtureSource(), cfg)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	got, err := RunRamOptimized(context.Background(), fixtureSource(), cfg)
+	if err != nil {
+		t.Fatalf("RunRamOptimized: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d rows, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Fatalf("row %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package calculator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"ltv-monthly/pkg/models"
+)
+
+// ModeIncremental est le nom du mode incrémental (logs et table de résultats) ; son Runner se construit avec RunIncremental.
+const ModeIncremental = "incremental"
+
+// IncrementalSource est implémentée par les sources capables de ne transmettre qu'une fenêtre d'événements
+// et de les dénombrer, ce qu'exige le calcul incrémental.
+type IncrementalSource interface {
+	// StreamOrderEventsBetween transmet à fn les événements de commande dont EventDate est dans [from, to).
+	StreamOrderEventsBetween(ctx context.Context, from, to time.Time, cfg models.Config, fn func(models.RawEventData) error) error
+	// CountOrderEvents compte les événements que StreamOrderEvents transmettrait pour l'observation before.
+	CountOrderEvents(ctx context.Context, before time.Time, cfg models.Config) (int, error)
+}
+
+// StateStore persiste l'état du calcul incrémental entre deux exécutions.
+type StateStore interface {
+	// LoadState renvoie le dernier état enregistré, ou nil s'il n'y en a pas encore.
+	LoadState(ctx context.Context) (*models.State, error)
+	// SaveState remplace l'état enregistré.
+	SaveState(ctx context.Context, st *models.State) error
+}
+
+// RunIncremental renvoie un Runner qui repart de l'état de store : seuls les événements de
+// [observation précédente, nouvelle observation) sont chargés puis fusionnés aux agrégats par client.
+// L'état est reconstruit depuis tout l'historique si fullRebuild est demandé, s'il n'existe pas,
+// si les paramètres ont changé, si l'observation recule, ou si la source ne compte plus autant
+// d'événements avant l'observation précédente (événements insérés ou supprimés a posteriori).
+// Les résultats sont ceux de Run ; l'état est enregistré à la nouvelle observation.
+func RunIncremental(store StateStore, fullRebuild bool) Runner {
+	return func(ctx context.Context, src EventSource, cfg models.Config) ([]models.CohortResult, error) {
+		cfg = normalizeConfig(cfg)
+		periods, g, err := ParsePeriod(cfg)
+		if err != nil {
+			return nil, err
+		}
+		inc, ok := src.(IncrementalSource)
+		if !ok {
+			return nil, fmt.Errorf("mode %s: la source %T ne sait pas charger une fenêtre d'événements", ModeIncremental, src)
+		}
+		if err := checkIncremental(cfg); err != nil {
+			return nil, err
+		}
+
+		fingerprint := stateFingerprint(cfg)
+		var st *models.State
+		if !fullRebuild {
+			if st, err = store.LoadState(ctx); err != nil {
+				return nil, fmt.Errorf("load state: %w", err)
+			}
+			if st, err = usableState(ctx, inc, st, fingerprint, cfg); err != nil {
+				return nil, err
+			}
+		}
+
+		var agg *aggregator
+		if st == nil {
+			if cfg.Verbose {
+				log.Printf("[INFO] [STATE] full rebuild: load events < %s", cfg.Observation.Format(time.RFC3339))
+			}
+			// même chargement que Run : par plages de CustomerID parallèles si la source le permet
+			agg, err = aggregateEvents(ctx, src, cfg, false, tracking{})
+		} else {
+			if cfg.Verbose {
+				log.Printf("[INFO] [STATE] %d customers as of %s, load events in [%s, %s)", len(st.Customers),
+					st.Observation.Format(time.RFC3339), st.Observation.Format(time.RFC3339), cfg.Observation.Format(time.RFC3339))
+			}
+			agg = newAggregator(cfg, tracking{})
+			agg.restore(st)
+			if st.Observation.Before(cfg.Observation) {
+				err = inc.StreamOrderEventsBetween(ctx, st.Observation, cfg.Observation, cfg, agg.add)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if err := store.SaveState(ctx, agg.snapshot(cfg.Observation, fingerprint)); err != nil {
+			return nil, fmt.Errorf("save state: %w", err)
+		}
+		if cfg.Verbose {
+			log.Printf("[INFO] [STATE] saved %d customers as of %s", len(agg.customers), cfg.Observation.Format(time.RFC3339))
+		}
+		return projectCustomers(agg, g, periods, cfg), nil
+	}
+}
+
+// usableState renvoie st s'il peut être complété jusqu'à cfg.Observation, nil s'il faut tout reconstruire.
+func usableState(ctx context.Context, src IncrementalSource, st *models.State, fingerprint string, cfg models.Config) (*models.State, error) {
+	switch {
+	case st == nil:
+		return nil, nil
+	case st.Fingerprint != fingerprint:
+		log.Printf("[WARN] [STATE] paramètres modifiés depuis le dernier calcul, reconstruction complète")
+		return nil, nil
+	case cfg.Observation.Before(st.Observation):
+		log.Printf("[WARN] [STATE] observation %s antérieure à l'état (%s), reconstruction complète",
+			cfg.Observation.Format(time.RFC3339), st.Observation.Format(time.RFC3339))
+		return nil, nil
+	}
+	n, err := src.CountOrderEvents(ctx, st.Observation, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("state consistency check: %w", err)
+	}
+	if n != st.EventsRead {
+		log.Printf("[WARN] [STATE] %d événements avant %s dans la source, %d dans l'état : reconstruction complète",
+			n, st.Observation.Format(time.RFC3339), st.EventsRead)
+		return nil, nil
+	}
+	return st, nil
+}
+
+// checkIncremental refuse les options qui demandent plus que les agrégats persistés par client.
+func checkIncremental(cfg models.Config) error {
+	var unsupported []string
+	if cfg.Currency != nil {
+		unsupported = append(unsupported, "currency")
+	}
+	if len(cfg.PredictHorizons) > 0 {
+		unsupported = append(unsupported, "predict")
+	}
+	if cfg.Retention {
+		unsupported = append(unsupported, "retention")
+	}
+	if len(unsupported) > 0 {
+		return fmt.Errorf("mode %s: options non disponibles: %v", ModeIncremental, unsupported)
+	}
+	return nil
+}
+
+// stateFingerprint résume les paramètres dont dépendent les agrégats persistés ;
+// la granularité et l'arrondi n'interviennent qu'à la projection et n'en font pas partie.
+func stateFingerprint(cfg models.Config) string {
+	refunds := append([]int(nil), cfg.RefundEventTypeIDs...)
+	sort.Ints(refunds)
+	h := sha256.New()
+	fmt.Fprintf(h, "%+v|%v|%q", cfg.Schema, refunds, cfg.SegmentBy)
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// restore reprend les agrégats par client de st.
+func (a *aggregator) restore(st *models.State) {
+	a.eventsRead = st.EventsRead
+	for _, c := range st.Customers {
+		a.customers[c.CustomerID] = &customerAgg{
+			First:        c.First,
+			firstEventID: c.FirstEventID,
+			Revenue:      c.Revenue,
+			Events:       c.Events,
+			Refunds:      c.Refunds,
+			Segments:     c.Segments,
+		}
+	}
+}
+
+// snapshot renvoie l'état à persister pour l'observation obs, clients triés par CustomerID.
+func (a *aggregator) snapshot(obs time.Time, fingerprint string) *models.State {
+	st := &models.State{
+		Observation: obs,
+		Fingerprint: fingerprint,
+		EventsRead:  a.eventsRead,
+		Customers:   make([]models.CustomerState, 0, len(a.customers)),
+	}
+	for id, c := range a.customers {
+		st.Customers = append(st.Customers, models.CustomerState{
+			CustomerID:   id,
+			First:        c.First,
+			FirstEventID: c.firstEventID,
+			Revenue:      c.Revenue,
+			Events:       c.Events,
+			Refunds:      c.Refunds,
+			Segments:     c.Segments,
+		})
+	}
+	sort.Slice(st.Customers, func(i, j int) bool { return st.Customers[i].CustomerID < st.Customers[j].CustomerID })
+	return st
+}
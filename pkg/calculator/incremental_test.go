@@ -0,0 +1,156 @@
+package calculator
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"ltv-monthly/pkg/models"
+)
+
+func (f *fakeSource) StreamOrderEventsBetween(ctx context.Context, from, to time.Time, cfg models.Config, fn func(models.RawEventData) error) error {
+	for _, ev := range f.events {
+		if ev.EventDate.Before(from) || !ev.EventDate.Before(to) {
+			continue
+		}
+		f.windowEvents++
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeSource) CountOrderEvents(ctx context.Context, before time.Time, cfg models.Config) (int, error) {
+	n := 0
+	for _, ev := range f.events {
+		if ev.EventDate.Before(before) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// memStore est un StateStore en mémoire.
+type memStore struct {
+	st    *models.State
+	saves int
+}
+
+func (m *memStore) LoadState(ctx context.Context) (*models.State, error) { return m.st, nil }
+
+func (m *memStore) SaveState(ctx context.Context, st *models.State) error {
+	m.st = st
+	m.saves++
+	return nil
+}
+
+func TestRunIncremental_MatchesRun(t *testing.T) {
+	src := fixtureSource()
+	src.events = append(src.events,
+		models.RawEventData{EventID: 6, CustomerID: 2, EventTypeID: 7, EventDate: day(2025, 2, 25), Quantity: 1, UnitPrice: eur(10)},
+	)
+	store := &memStore{}
+
+	// 1er calcul au 1er février : reconstruction complète
+	cfg := fixtureConfig()
+	cfg.RefundEventTypeIDs = []int{7}
+	cfg.Observation = day(2025, 2, 1)
+	if _, err := RunIncremental(store, false)(context.Background(), src, cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if store.st == nil || store.st.EventsRead != 2 || !store.st.Observation.Equal(cfg.Observation) {
+		t.Fatalf("unexpected state: %+v", store.st)
+	}
+
+	// 2e calcul au 1er mars : seuls les événements de février sont chargés
+	cfg.Observation = day(2025, 3, 1)
+	got, err := RunIncremental(store, false)(context.Background(), src, cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if src.windowEvents != 3 {
+		t.Fatalf("loaded %d events in the window, want 3", src.windowEvents)
+	}
+	want, err := Run(context.Background(), src, cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("incremental differs from Run:\n got %+v\nwant %+v", got, want)
+	}
+	if store.st.EventsRead != 5 {
+		t.Fatalf("state has %d events, want 5", store.st.EventsRead)
+	}
+}
+
+func TestRunIncremental_PartitionedRebuild(t *testing.T) {
+	cfg := fixtureConfig()
+	cfg.Partitions, cfg.LoadWorkers = 2, 2
+	want, err := Run(context.Background(), fixtureSource(), cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := RunIncremental(&memStore{}, false)(context.Background(), fixtureSource(), cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("incremental differs from Run:\n got %+v\nwant %+v", got, want)
+	}
+
+	// la reconstruction complète passe par les plages de CustomerID
+	src := fixtureSource()
+	src.rangeErr = errors.New("range failed")
+	if _, err := RunIncremental(&memStore{}, false)(context.Background(), src, cfg); !errors.Is(err, src.rangeErr) {
+		t.Fatalf("got %v, want the partition error", err)
+	}
+}
+
+func TestRunIncremental_Rebuild(t *testing.T) {
+	cfg := fixtureConfig()
+	for name, tc := range map[string]struct {
+		change      func(src *fakeSource, cfg *models.Config)
+		fullRebuild bool
+	}{
+		"full rebuild flag": {func(*fakeSource, *models.Config) {}, true},
+		// achat de janvier inséré après le premier calcul : le contrôle de cohérence le détecte
+		"late event": {func(src *fakeSource, _ *models.Config) {
+			src.events = append(src.events, models.RawEventData{EventID: 9, CustomerID: 5, EventDate: day(2025, 1, 15), Quantity: 1, UnitPrice: eur(40)})
+		}, false},
+		"parameters changed": {func(_ *fakeSource, cfg *models.Config) { cfg.SegmentBy = []string{"$.channel"} }, false},
+	} {
+		src := fixtureSource()
+		store := &memStore{}
+		if _, err := RunIncremental(store, false)(context.Background(), src, cfg); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		next := cfg
+		tc.change(src, &next)
+		src.windowEvents = 0
+
+		got, err := RunIncremental(store, tc.fullRebuild)(context.Background(), src, next)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		want, _ := Run(context.Background(), src, next)
+		if !reflect.DeepEqual(got, want) || src.windowEvents != 0 {
+			t.Fatalf("%s: expected a full rebuild matching Run:\n got %+v\nwant %+v", name, got, want)
+		}
+	}
+}
+
+func TestRunIncremental_Errors(t *testing.T) {
+	opaque := struct{ EventSource }{fixtureSource()}
+	if _, err := RunIncremental(&memStore{}, false)(context.Background(), opaque, fixtureConfig()); err == nil {
+		t.Fatal("expected error for a source without IncrementalSource, got nil")
+	}
+	cfg := fixtureConfig()
+	cfg.Retention = true
+	store := &memStore{}
+	if _, err := RunIncremental(store, false)(context.Background(), fixtureSource(), cfg); err == nil || store.saves != 0 {
+		t.Fatalf("expected error without saving the state, got %v (%d saves)", err, store.saves)
+	}
+}
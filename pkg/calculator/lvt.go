@@ -2,46 +2,39 @@ package calculator
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 	"log"
-	"ltv-monthly/pkg/database"
 	"ltv-monthly/pkg/models"
 	"time"
 )
 
 // RunRamOptimized est une version optimisée du calcul de LTV.
-func RunRamOptimized(ctx context.Context, db *sql.DB, cfg models.Config) ([]models.CohortResult, error) {
+func RunRamOptimized(ctx context.Context, src EventSource, cfg models.Config) ([]models.CohortResult, error) {
+	cfg = normalizeConfig(cfg)
 
 	// Date Validation
-	start, err := parseMonth(cfg.StartMonthInclusive)
+	periods, g, err := ParsePeriod(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("start_month: %w", err)
-	}
-	end, err := parseMonth(cfg.EndMonthInclusive)
-	if err != nil {
-		return nil, fmt.Errorf("end_month: %w", err)
-	}
-	if end.Before(start) {
-		return nil, fmt.Errorf("end_date < start_date")
+		return nil, err
 	}
 
-	months := monthsBetweenInclusive(start, end)
-	rangeEnd := time.Date(end.Year(), end.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, 1, 0)
+	start := periods[0]
+	rangeEnd := g.next(periods[len(periods)-1])
 
 	// 2. [OPTIMISATION] Charge uniquement les clients dont la première commande
 	// se situe dans la plage de dates des cohortes. Le calcul du MIN(EventDate)
 	// est délégué à la base de données, ce qui est beaucoup plus performant.
-	allCohortCustomers, err := database.LoadCohortCustomers(ctx, db, start, rangeEnd, cfg)
+	allCohortCustomers, err := src.LoadCohortCustomers(ctx, start, rangeEnd, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("load cohort customers: %w", err)
 	}
 	if len(allCohortCustomers) == 0 {
 		// nothing to compute; still return rows with zeros for each month
-		results := make([]models.CohortResult, 0, len(months))
-		for _, m := range months {
+		results := make([]models.CohortResult, 0, len(periods))
+		for _, p := range periods {
 			results = append(results, models.CohortResult{
-				MonthYear:     fmt.Sprintf("%02d/%04d", int(m.Month()), m.Year()),
+				MonthYear:     g.label(p),
+				PeriodStart:   p,
 				LTVAvg:        0,
 				CohortClients: 0,
 				EventsRead:    0,
@@ -52,10 +45,8 @@ func RunRamOptimized(ctx context.Context, db *sql.DB, cfg models.Config) ([]mode
 
 	// Prépare les structures de données pour les étapes suivantes.
 	customersIDs := make([]models.CohortCustomer, 0, len(allCohortCustomers))
-	firstByCustomer := make(map[uint64]time.Time, len(allCohortCustomers))
 	for _, cc := range allCohortCustomers {
 		customersIDs = append(customersIDs, models.CohortCustomer{CustomerID: cc.CustomerID})
-		firstByCustomer[cc.CustomerID] = cc.FirstOrderDT
 	}
 
 	if cfg.Verbose {
@@ -63,98 +54,101 @@ func RunRamOptimized(ctx context.Context, db *sql.DB, cfg models.Config) ([]mode
 			len(customersIDs), cfg.Observation.UTC().Format(time.RFC3339))
 	}
 
-	// 3. [OPTIMISATION] Charge les événements de commande UNIQUEMENT pour les clients identifiés précédemment.
-	events, err := database.LoadOrderEventsWithCustomersID(ctx, db, customersIDs, cfg.Observation, cfg)
-	if err != nil {
-		return nil, fmt.Errorf("load events: %w", err)
+	// 3. [OPTIMISATION] Charge les événements de commande UNIQUEMENT pour les clients identifiés précédemment,
+	// 4. et agrège le revenu total pour chaque client (sur le jeu de données réduit), au fil de l'eau si la source le permet.
+	agg := newAggregator(cfg, tracking{days: len(cfg.PredictHorizons) > 0 || cfg.Retention})
+	if cs, ok := src.(CustomerEventStreamer); ok {
+		err = cs.StreamOrderEventsWithCustomersID(ctx, customersIDs, cfg.Observation, cfg, agg.add)
+		if err != nil {
+			return nil, fmt.Errorf("load events: %w", err)
+		}
+	} else {
+		events, err := src.LoadOrderEventsWithCustomersID(ctx, customersIDs, cfg.Observation, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("load events: %w", err)
+		}
+		for _, ev := range events {
+			if err := agg.add(ev); err != nil {
+				return nil, err
+			}
+		}
 	}
-
 	if cfg.Verbose {
-		log.Printf("[INFO] [STEP] Aggregate purchases per customer (UnitPrice*Quantity)")
+		log.Printf("[INFO] [STEP] aggregated purchases and refunds per customer (UnitPrice*Quantity): events=%d", agg.eventsRead)
 	}
-
-	// 4. Agrège le revenu total pour chaque client (sur le jeu de données réduit).
-	sumByCustomer := make(map[uint64]float64, len(customersIDs))
-	eventsCountByCustomer := make(map[uint64]int, len(customersIDs))
-
-	for _, ev := range events {
-		if ev.UnitPrice > 0 && ev.Quantity > 0 {
-			sumByCustomer[ev.CustomerID] += ev.UnitPrice * float64(ev.Quantity)
-			eventsCountByCustomer[ev.CustomerID]++
-		}
+	agg.logUnconverted()
+	if err := predictCustomers(agg, start, rangeEnd, cfg); err != nil {
+		return nil, err
 	}
 
-	// 5. Itère sur chaque mois pour construire les cohortes et calculer la LTV.
-	results := make([]models.CohortResult, 0, len(months))
-	for _, m := range months {
-		cohortStart := time.Date(m.Year(), m.Month(), 1, 0, 0, 0, 0, time.UTC)
-		cohortEnd := cohortStart.AddDate(0, 1, 0)
-
-		cohortClients := 0
-		totalRevenue := 0.0
-		totalEvents := 0
-
-		for _, cc := range allCohortCustomers {
-			first := firstByCustomer[cc.CustomerID]
-			if !first.Before(cohortStart) && first.Before(cohortEnd) {
-				cohortClients++
-				totalRevenue += sumByCustomer[cc.CustomerID]
-				totalEvents += eventsCountByCustomer[cc.CustomerID]
-			}
-		}
-
-		ltv := 0.0
-		if cohortClients > 0 {
-			ltv = totalRevenue / float64(cohortClients)
-		}
-
-		results = append(results, models.CohortResult{
-			MonthYear:     fmt.Sprintf("%02d/%04d", int(m.Month()), m.Year()),
-			LTVAvg:        ltv,
-			CohortClients: cohortClients,
-			EventsRead:    totalEvents, // priced events used in revenue
-		})
-
-		if cfg.Verbose {
-			log.Printf("[INFO] %s -> LTV=%.6f | clients=%d | events=%d",
-				fmt.Sprintf("%02d/%04d", int(m.Month()), m.Year()),
-				ltv, cohortClients, totalEvents)
-		}
+	// 5. Affecte chaque client à sa cohorte (première commande calculée par la base) et calcule la LTV.
+	proj := newProjection(g, len(periods), cfg)
+	for _, cc := range allCohortCustomers {
+		proj.add(cc.FirstOrderDT, agg.customers[cc.CustomerID])
 	}
+	results := proj.results(periods, cfg)
 
 	return results, nil
 }
 
-
 // runCore factorise Run et RunWithInsertDateFromCustomerEvent
-func runCore(ctx context.Context, db *sql.DB, cfg models.Config, useInsertDate bool) ([]models.CohortResult, error) {
+func runCore(ctx context.Context, src EventSource, cfg models.Config, useInsertDate bool) ([]models.CohortResult, error) {
+	cfg = normalizeConfig(cfg)
 	// 0) validation
-	start, err := parseMonth(cfg.StartMonthInclusive)
+	periods, g, err := ParsePeriod(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("start_month: %w", err)
+		return nil, err
+	}
+
+	if cfg.Verbose {
+		log.Printf("[INFO] [STEP] Load events < Observation=%s", cfg.Observation.Format(time.RFC3339))
 	}
-	end, err := parseMonth(cfg.EndMonthInclusive)
+
+	// 1) chargement des events (+ override InsertDate si demandé) et
+	// 2) agrégation en 1 seul passage, au fil de l'eau quand c'est possible
+	agg, err := aggregateEvents(ctx, src, cfg, useInsertDate, tracking{days: len(cfg.PredictHorizons) > 0 || cfg.Retention})
 	if err != nil {
-		return nil, fmt.Errorf("end_month: %w", err)
+		return nil, err
 	}
-	if end.Before(start) {
-		return nil, fmt.Errorf("end_date < start_date")
+	agg.logUnconverted()
+	if err := predictCustomers(agg, periods[0], g.next(periods[len(periods)-1]), cfg); err != nil {
+		return nil, err
 	}
-	months := monthsBetweenInclusive(start, end)
 
 	if cfg.Verbose {
-		log.Printf("[INFO] [STEP] Load events < Observation=%s", cfg.Observation.Format(time.RFC3339))
+		log.Printf("[INFO] [STEP] aggregated: events=%d, eventsWithPrice=%d, refundEvents=%d, customers=%d",
+			agg.eventsRead, agg.eventsWithPrice, agg.refundEvents, len(agg.customers))
+		log.Printf("[INFO] [STEP] project to cohorts per %s", g)
 	}
 
+	// 3) projection en cohortes et 4) construction des résultats dans l’ordre des périodes demandées
+	return projectCustomers(agg, g, periods, cfg), nil
+}
+
+// projectCustomers affecte chaque client agrégé ayant acheté à sa cohorte et construit les résultats de periods.
+func projectCustomers(agg *aggregator, g Granularity, periods []time.Time, cfg models.Config) []models.CohortResult {
+	proj := newProjection(g, len(periods), cfg)
+	for _, c := range agg.customers {
+		if c.First.IsZero() {
+			continue
+		}
+		proj.add(c.First, c)
+	}
+	return proj.results(periods, cfg)
+}
+
+// loadEvents charge les événements d'achat antérieurs à Observation et, si demandé,
+// remplace leur EventDate par l'InsertDate correspondante de CustomerEvent.
+func loadEvents(ctx context.Context, src EventSource, cfg models.Config, useInsertDate bool) ([]models.RawEventData, error) {
 	// 1) chargement des events
-	events, err := database.LoadOrderEvents(ctx, db, cfg.Observation, cfg)
+	events, err := src.LoadOrderEvents(ctx, cfg.Observation, cfg)
 	if err != nil {
 		return nil, err
 	}
 
 	// 1b) si demandé, override EventDate par InsertDate
 	if useInsertDate {
-		ins, err := database.LoadOrdersInsertDate(ctx, db, events, cfg.Observation, cfg)
+		ins, err := src.LoadOrdersInsertDate(ctx, events, cfg.Observation, cfg)
 		if err != nil {
 			return nil, err
 		}
@@ -171,88 +165,93 @@ func runCore(ctx context.Context, db *sql.DB, cfg models.Config, useInsertDate b
 			}
 		}
 	}
+	return events, nil
+}
 
-	// 2) agrégation en 1 seul passage (pas besoin de customersSet + passes séparées)
-	minFirst := make(map[uint64]time.Time, 1024)
-	sumByCustomer := make(map[uint64]float64, 1024)
-	eventsByCustomer := make(map[uint64]int, 1024)
-
-	eventsRead := len(events)
-	eventsWithPrice := 0
+func Run(ctx context.Context, src EventSource, cfg models.Config) ([]models.CohortResult, error) {
+	return runCore(ctx, src, cfg, false)
+}
 
-	for _, ev := range events {
-		// min première date
-		if t0, ok := minFirst[ev.CustomerID]; !ok || ev.EventDate.Before(t0) || t0.IsZero() {
-			minFirst[ev.CustomerID] = ev.EventDate
-		}
-		// revenus + nombre d'événements "pricing"
-		if ev.UnitPrice > 0 && ev.Quantity > 0 {
-			sumByCustomer[ev.CustomerID] += ev.UnitPrice * float64(ev.Quantity)
-			eventsByCustomer[ev.CustomerID]++
-			eventsWithPrice++
-		}
-	}
+func RunWithInsertDateFromCustomerEvent(ctx context.Context, src EventSource, cfg models.Config) ([]models.CohortResult, error) {
+	return runCore(ctx, src, cfg, true)
+}
 
-	if cfg.Verbose {
-		log.Printf("[INFO] [STEP] aggregated: events=%d, eventsWithPrice=%d, customers=%d",
-			eventsRead, eventsWithPrice, len(minFirst))
-		log.Printf("[INFO] [STEP] project to cohorts per month")
+// normalizeConfig complète cfg avec les valeurs par défaut :
+// sans Observation explicite, on observe au 1er jour du mois courant (UTC) ; cohortes mensuelles par défaut.
+func normalizeConfig(cfg models.Config) models.Config {
+	if cfg.Observation.IsZero() {
+		cfg.Observation = DefaultObservation(time.Now())
 	}
-
-	// 3) projection en cohortes
-	type bucket struct {
-		clients int
-		total   float64
-		events  int
+	cfg.Observation = cfg.Observation.UTC()
+	if cfg.Granularity == "" {
+		cfg.Granularity = string(GranularityMonth)
 	}
-	byMonth := make(map[string]bucket, len(months))
-
-	for cid, first := range minFirst {
-		if first.IsZero() {
-			continue
-		}
-		key := formatMonth(time.Date(first.Year(), first.Month(), 1, 0, 0, 0, 0, time.UTC))
-		b := byMonth[key]
-		b.clients++
-		b.total += sumByCustomer[cid]
-		b.events += eventsByCustomer[cid]
-		byMonth[key] = b
+	if cfg.Rounding == "" {
+		cfg.Rounding = models.RoundHalfEven
 	}
+	return cfg
+}
 
-	// 4) construction des résultats dans l’ordre des mois demandés
-	results := make([]models.CohortResult, 0, len(months))
-	for _, m := range months {
-		cohortStart := time.Date(m.Year(), m.Month(), 1, 0, 0, 0, 0, time.UTC)
-		key := formatMonth(cohortStart)
-		b := byMonth[key]
-
-		ltv := 0.0
-		if b.clients > 0 {
-			ltv = b.total / float64(b.clients)
-		}
-
-		results = append(results, models.CohortResult{
-			MonthYear:     key,
-			LTVAvg:        ltv,
-			CohortClients: b.clients,
-			EventsRead:    b.events,
-		})
+// DefaultObservation renvoie le 1er jour du mois de now (UTC).
+func DefaultObservation(now time.Time) time.Time {
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
 
-		if cfg.Verbose {
-			log.Printf("[INFO] %s -> LTV=%.6f | clients=%d | events=%d", key, ltv, b.clients, b.events)
-		}
+// ParseObservation convertit la borne d'observation saisie par l'utilisateur.
+// Formats acceptés : "MMYYYY" (1er jour du mois), "YYYY-MM-DD" ou RFC3339 ; le résultat est en UTC.
+// La borne est exclusive : seuls les événements strictement antérieurs sont pris en compte.
+func ParseObservation(s string) (time.Time, error) {
+	if len(s) == 6 {
+		return parseMonth(s)
 	}
-
-	return results, nil
-}
-func Run(ctx context.Context, db *sql.DB, cfg models.Config) ([]models.CohortResult, error) {
-	return runCore(ctx, db, cfg, false)
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("format attendu MMYYYY, YYYY-MM-DD ou RFC3339 (ex: 032025, 2025-03-15)")
 }
 
-func RunWithInsertDateFromCustomerEvent(ctx context.Context, db *sql.DB, cfg models.Config) ([]models.CohortResult, error) {
-	return runCore(ctx, db, cfg, true)
+// ParsePeriod valide la granularité et les bornes StartMonthInclusive / EndMonthInclusive de cfg et renvoie
+// les débuts de période (selon cfg.Granularity) couverts, dans l'ordre, ainsi que la granularité.
+// Une borne "MMYYYY" couvre tout le mois : avec des semaines, -end_month=032025 inclut la semaine du 31/03.
+func ParsePeriod(cfg models.Config) ([]time.Time, Granularity, error) {
+	g, err := ParseGranularity(cfg.Granularity)
+	if err != nil {
+		return nil, "", err
+	}
+	start, _, err := parseBound(cfg.StartMonthInclusive)
+	if err != nil {
+		return nil, "", fmt.Errorf("start_month: %w", err)
+	}
+	_, endExclusive, err := parseBound(cfg.EndMonthInclusive)
+	if err != nil {
+		return nil, "", fmt.Errorf("end_month: %w", err)
+	}
+	end := endExclusive.Add(-time.Nanosecond)
+	if end.Before(start) {
+		return nil, "", fmt.Errorf("end_date < start_date")
+	}
+	return g.periodsBetweenInclusive(start, end), g, nil
 }
 
+// parseBound convertit une borne de période "MMYYYY" (mois entier) ou "YYYY-MM-DD" (jour)
+// en intervalle [from, to) UTC.
+func parseBound(s string) (time.Time, time.Time, error) {
+	if len(s) == 6 {
+		m, err := parseMonth(s)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		return m, m.AddDate(0, 1, 0), nil
+	}
+	if d, err := time.Parse("2006-01-02", s); err == nil {
+		return d, d.AddDate(0, 0, 1), nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("format attendu MMYYYY ou YYYY-MM-DD (ex: 012025, 2025-01-13)")
+}
 
 // parseMonth("MMYYYY") -> 1er jour du mois UTC
 func parseMonth(mmyyyy string) (time.Time, error) {
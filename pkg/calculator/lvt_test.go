@@ -49,3 +49,30 @@ func TestFormatMonth(t *testing.T) {
 		t.Fatalf("got %q, want %q", fm, "11/2025")
 	}
 }
+
+func TestParseObservation(t *testing.T) {
+	cases := map[string]time.Time{
+		"032025":               time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+		"2025-03-15":           time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC),
+		"2025-03-15T10:00:00Z": time.Date(2025, 3, 15, 10, 0, 0, 0, time.UTC),
+	}
+	for in, want := range cases {
+		got, err := ParseObservation(in)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", in, err)
+		}
+		if !got.Equal(want) {
+			t.Fatalf("%q: got %v, want %v", in, got, want)
+		}
+	}
+	if _, err := ParseObservation("15/03/2025"); err == nil {
+		t.Fatal("expected error for unsupported format, got nil")
+	}
+}
+
+func TestDefaultObservation(t *testing.T) {
+	got := DefaultObservation(time.Date(2025, 8, 17, 13, 4, 0, 0, time.UTC))
+	if want := time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,34 @@
+package calculator
+
+import (
+	"context"
+	"fmt"
+
+	"ltv-monthly/pkg/models"
+)
+
+// Runner est la signature commune des modes de calcul de la LTV par cohorte.
+type Runner func(ctx context.Context, src EventSource, cfg models.Config) ([]models.CohortResult, error)
+
+// Noms des modes de calcul, utilisés par la CLI, l'API HTTP et la table de résultats.
+const (
+	ModeNormal         = "normal"
+	ModeRamOptimized   = "ramOptimized"
+	ModeWithInsertDate = "withInsertDate"
+	ModePushdown       = "pushdown"
+)
+
+// RunnerFor renvoie la fonction de calcul associée à mode ("" = normal).
+func RunnerFor(mode string) (Runner, error) {
+	switch mode {
+	case ModeNormal, "":
+		return Run, nil
+	case ModeRamOptimized:
+		return RunRamOptimized, nil
+	case ModeWithInsertDate:
+		return RunWithInsertDateFromCustomerEvent, nil
+	case ModePushdown:
+		return RunPushdown, nil
+	}
+	return nil, fmt.Errorf("mode inconnu %q (attendu: %s, %s, %s, %s)", mode, ModeNormal, ModeRamOptimized, ModeWithInsertDate, ModePushdown)
+}
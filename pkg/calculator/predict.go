@@ -0,0 +1,87 @@
+package calculator
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"ltv-monthly/pkg/models"
+	"ltv-monthly/pkg/predict"
+)
+
+// predictCustomers ajuste BG/NBD + Gamma-Gamma sur les clients des cohortes demandées (première commande
+// dans [from, to)) puis renseigne, pour chacun, le revenu futur attendu à chaque horizon de cfg.PredictHorizons.
+// La population d'ajustement est donc la même quel que soit le mode (Run charge tout l'historique, ramOptimized
+// seulement ces clients) : les paramètres dépendent des données, de la plage de cohortes et de l'observation.
+// Sans horizon demandé, ne fait rien.
+func predictCustomers(agg *aggregator, from, to time.Time, cfg models.Config) error {
+	if len(cfg.PredictHorizons) == 0 {
+		return nil
+	}
+	ids := make([]uint64, 0, len(agg.customers))
+	rfm := make(map[uint64]predict.Customer, len(agg.customers))
+	for id, c := range agg.customers {
+		if c.First.IsZero() || c.First.Before(from) || !c.First.Before(to) {
+			continue
+		}
+		if pc, ok := customerRFM(c, cfg); ok {
+			ids = append(ids, id)
+			rfm[id] = pc
+		}
+	}
+	// ordre stable : l'ajustement ne dépend pas de l'ordre d'itération de la map
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	sample := make([]predict.Customer, len(ids))
+	for i, id := range ids {
+		sample[i] = rfm[id]
+	}
+
+	m, err := predict.Fit(sample)
+	if err != nil {
+		return fmt.Errorf("predict: %w", err)
+	}
+	if cfg.Verbose {
+		log.Printf("[INFO] [STEP] predict: %d customers, BG/NBD r=%.4f alpha=%.4f a=%.4f b=%.4f, Gamma-Gamma p=%.4f q=%.4f gamma=%.4f",
+			len(sample), m.Transactions.R, m.Transactions.Alpha, m.Transactions.A, m.Transactions.B,
+			m.Value.P, m.Value.Q, m.Value.Gamma)
+	}
+
+	for id, pc := range rfm {
+		c := agg.customers[id]
+		c.Predicted = make([]models.Money, len(cfg.PredictHorizons))
+		for i, h := range cfg.PredictHorizons {
+			v := m.ExpectedRevenue(pc, h)
+			// garde-fou : une valeur non finie rendrait les sorties JSON illisibles
+			if math.IsNaN(v) || math.Abs(v*1e6) >= math.MaxInt64 {
+				return fmt.Errorf("predict: revenu prédit invalide (%g) pour le client %d à %d mois", v, id, h)
+			}
+			c.Predicted[i] = models.MoneyFromFloat(v)
+		}
+	}
+	return nil
+}
+
+// customerRFM résume les jours d'achat d'un client en (fréquence, récence, âge, valeur moyenne),
+// en semaines jusqu'à cfg.Observation ; ok = false sans achat valorisé.
+func customerRFM(c *customerAgg, cfg models.Config) (predict.Customer, bool) {
+	if len(c.RevenueByDay) == 0 {
+		return predict.Customer{}, false
+	}
+	first, last := math.MaxInt, math.MinInt
+	for d := range c.RevenueByDay {
+		first = min(first, d)
+		last = max(last, d)
+	}
+	obsDays := float64(cfg.Observation.Unix()) / 86400
+	pc := predict.Customer{
+		Frequency: len(c.RevenueByDay) - 1,
+		Recency:   float64(last-first) / 7,
+		T:         (obsDays - float64(first)) / 7,
+	}
+	if pc.Frequency > 0 {
+		pc.Monetary = (c.Revenue - c.RevenueByDay[first]).Float64() / float64(pc.Frequency)
+	}
+	return pc, true
+}
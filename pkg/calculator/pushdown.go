@@ -0,0 +1,108 @@
+package calculator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"ltv-monthly/pkg/models"
+)
+
+// RunPushdown délègue l'affectation aux cohortes et l'agrégation du revenu à la source
+// (une requête SQL groupée pour database.SQLSource) : seule une ligne par période de cohorte est transférée.
+// Les options qui exigent le détail par client ou par événement ne sont pas disponibles dans ce mode.
+func RunPushdown(ctx context.Context, src EventSource, cfg models.Config) ([]models.CohortResult, error) {
+	cfg = normalizeConfig(cfg)
+	periods, g, err := ParsePeriod(cfg)
+	if err != nil {
+		return nil, err
+	}
+	agg, ok := src.(CohortAggregator)
+	if !ok {
+		return nil, fmt.Errorf("mode %s: la source %T ne sait pas agréger les cohortes", ModePushdown, src)
+	}
+	if err := CheckPushdown(cfg); err != nil {
+		return nil, err
+	}
+
+	if cfg.Verbose {
+		log.Printf("[INFO] [STEP] Aggregate cohorts in the source (< Observation=%s)", cfg.Observation.Format(time.RFC3339))
+	}
+	rows, err := agg.AggregateCohorts(ctx, periods[0], g.next(periods[len(periods)-1]), cfg)
+	if err != nil {
+		return nil, fmt.Errorf("aggregate cohorts: %w", err)
+	}
+
+	// mêmes buckets que runCore : moyennes, arrondis et lignes vides identiques
+	proj := newProjection(g, len(periods), cfg)
+	for _, r := range rows {
+		proj.addAggregate(r)
+	}
+	return proj.results(periods, cfg), nil
+}
+
+// CheckPushdown refuse les options calculées par client ou par événement, non disponibles en mode pushdown.
+func CheckPushdown(cfg models.Config) error {
+	var unsupported []string
+	if len(cfg.SegmentBy) > 0 {
+		unsupported = append(unsupported, "segment_by")
+	}
+	if cfg.Currency != nil {
+		unsupported = append(unsupported, "currency")
+	}
+	if len(cfg.PredictHorizons) > 0 {
+		unsupported = append(unsupported, "predict")
+	}
+	if cfg.Retention {
+		unsupported = append(unsupported, "retention")
+	}
+	if cfg.Distribution {
+		unsupported = append(unsupported, "distribution")
+	}
+	if cfg.Bootstrap.Iterations > 0 {
+		unsupported = append(unsupported, "bootstrap")
+	}
+	if len(unsupported) > 0 {
+		return fmt.Errorf("mode %s: options non disponibles: %v", ModePushdown, unsupported)
+	}
+	return nil
+}
+
+// AggregateInMemory implémente CohortAggregator pour les sources sans moteur de requête (fichiers) :
+// les événements de src sont agrégés par client avec l'aggregator de Run (premier achat, revenus et
+// remboursements), puis regroupés par période de cohorte comme la requête groupée du mode pushdown.
+func AggregateInMemory(ctx context.Context, src EventSource, cohortStart, cohortEnd time.Time, cfg models.Config) ([]models.CohortAggregate, error) {
+	g, err := ParseGranularity(cfg.Granularity)
+	if err != nil {
+		return nil, err
+	}
+	agg, err := aggregateEvents(ctx, src, cfg, false, tracking{})
+	if err != nil {
+		return nil, err
+	}
+
+	byPeriod := make(map[time.Time]*models.CohortAggregate)
+	for _, c := range agg.customers {
+		if c.First.IsZero() || c.First.Before(cohortStart) || !c.First.Before(cohortEnd) {
+			continue
+		}
+		start := g.Truncate(c.First)
+		a := byPeriod[start]
+		if a == nil {
+			a = &models.CohortAggregate{PeriodStart: start}
+			byPeriod[start] = a
+		}
+		a.Clients++
+		a.Revenue += c.Revenue
+		a.Events += c.Events
+		a.Refunds += c.Refunds
+	}
+	out := make([]models.CohortAggregate, 0, len(byPeriod))
+	for _, a := range byPeriod {
+		out = append(out, *a)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].PeriodStart.Before(out[j].PeriodStart) })
+	return out, nil
+}
@@ -0,0 +1,67 @@
+package calculator
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"ltv-monthly/pkg/models"
+)
+
+// AggregateCohorts agrège les événements en mémoire, comme filesource.Source ; la requête SQL groupée
+// de database.SQLSource est comparée à Run sur une base SQLite dans pkg/database.
+func (f *fakeSource) AggregateCohorts(ctx context.Context, cohortStart, cohortEnd time.Time, cfg models.Config) ([]models.CohortAggregate, error) {
+	return AggregateInMemory(ctx, f, cohortStart, cohortEnd, cfg)
+}
+
+// TestRunPushdown_Projection vérifie que la projection des agrégats par période (moyennes, arrondis,
+// cohortes vides) donne les mêmes lignes que Run.
+func TestRunPushdown_Projection(t *testing.T) {
+	src := fixtureSource()
+	src.events = append(src.events,
+		models.RawEventData{EventID: 6, CustomerID: 2, EventTypeID: 7, EventDate: day(2025, 1, 25), Quantity: 1, UnitPrice: eur(10)},
+		models.RawEventData{EventID: 7, CustomerID: 9, EventTypeID: 7, EventDate: day(2025, 1, 2), Quantity: 1, UnitPrice: eur(50)},
+		models.RawEventData{EventID: 8, CustomerID: 4, EventDate: day(2025, 1, 31), Quantity: 3, UnitPrice: models.MoneyFromFloat(3.33)},
+	)
+
+	for _, granularity := range []string{"month", "week"} {
+		cfg := fixtureConfig()
+		cfg.Granularity = granularity
+		cfg.RefundEventTypeIDs = []int{7}
+
+		want, err := Run(context.Background(), src, cfg)
+		if err != nil {
+			t.Fatalf("%s: Run: unexpected error: %v", granularity, err)
+		}
+		got, err := RunPushdown(context.Background(), src, cfg)
+		if err != nil {
+			t.Fatalf("%s: RunPushdown: unexpected error: %v", granularity, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: results differ:\n got %+v\nwant %+v", granularity, got, want)
+		}
+	}
+}
+
+func TestRunPushdown_Errors(t *testing.T) {
+	// la source n'expose que EventSource : pas d'agrégation possible
+	opaque := struct{ EventSource }{fixtureSource()}
+	if _, err := RunPushdown(context.Background(), opaque, fixtureConfig()); err == nil {
+		t.Fatal("expected error for a source without CohortAggregator, got nil")
+	}
+
+	for name, set := range map[string]func(*models.Config){
+		"segment_by":   func(c *models.Config) { c.SegmentBy = []string{"$.channel"} },
+		"predict":      func(c *models.Config) { c.PredictHorizons = []int{6} },
+		"retention":    func(c *models.Config) { c.Retention = true },
+		"distribution": func(c *models.Config) { c.Distribution = true },
+		"bootstrap":    func(c *models.Config) { c.Bootstrap.Iterations = 100 },
+	} {
+		cfg := fixtureConfig()
+		set(&cfg)
+		if _, err := RunPushdown(context.Background(), fixtureSource(), cfg); err == nil {
+			t.Fatalf("%s: expected error, got nil", name)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package calculator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"ltv-monthly/pkg/models"
+)
+
+// Tolerance fixe les écarts acceptés entre un mode et le mode de référence lors d'une réconciliation.
+type Tolerance struct {
+	LTV     models.Money // écart absolu accepté sur ltv_avg
+	LTVRel  float64      // écart relatif accepté sur ltv_avg (0.01 = 1 % de la référence) ; le plus large des deux s'applique
+	Clients int          // écart accepté sur cohort_clients
+	Events  int          // écart accepté sur le nombre d'événements
+}
+
+// Reconcile exécute chaque mode de modes (au moins deux) sur la même configuration et compare,
+// cohorte par cohorte, LTV moyenne, clients et événements au premier mode, qui sert de référence.
+// Les lignes suivent l'ordre des résultats de la référence ; les cohortes présentes dans un seul mode sont ajoutées à la fin.
+func Reconcile(ctx context.Context, src EventSource, cfg models.Config, modes []string, tol Tolerance) ([]models.CohortReconciliation, error) {
+	if len(modes) < 2 {
+		return nil, fmt.Errorf("reconcile: au moins deux modes attendus, %d fourni(s)", len(modes))
+	}
+	runners := make([]Runner, len(modes))
+	for i, mode := range modes {
+		runner, err := RunnerFor(mode)
+		if err != nil {
+			return nil, err
+		}
+		runners[i] = runner
+	}
+
+	var rows []models.CohortReconciliation
+	index := make(map[string]int) // clé de cohorte → indice dans rows
+	for i, runner := range runners {
+		if cfg.Verbose {
+			log.Printf("[INFO] [RECONCILE] mode %s", modes[i])
+		}
+		results, err := runner(ctx, src, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("mode %s: %w", modes[i], err)
+		}
+		for _, r := range results {
+			key := cohortKey(r)
+			k, ok := index[key]
+			if !ok {
+				k = len(rows)
+				index[key] = k
+				row := models.CohortReconciliation{
+					MonthYear:   r.MonthYear,
+					PeriodStart: r.PeriodStart,
+					Segments:    r.Segments,
+					Values:      make([]models.ModeValues, len(modes)),
+				}
+				for j, mode := range modes {
+					row.Values[j] = models.ModeValues{Mode: mode, Missing: true}
+				}
+				rows = append(rows, row)
+			}
+			rows[k].Values[i] = models.ModeValues{
+				Mode:          modes[i],
+				LTVAvg:        r.LTVAvg,
+				CohortClients: r.CohortClients,
+				EventsRead:    r.EventsRead,
+			}
+		}
+	}
+
+	for i := range rows {
+		rows[i].Diverges = diverges(rows[i].Values, tol)
+	}
+	return rows, nil
+}
+
+// cohortKey identifie une cohorte par son libellé de période et ses valeurs de segments.
+func cohortKey(r models.CohortResult) string {
+	keys := make([]string, 0, len(r.Segments))
+	for k := range r.Segments {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	sb.WriteString(r.MonthYear)
+	for _, k := range keys {
+		sb.WriteString("\x00" + k + "=" + r.Segments[k])
+	}
+	return sb.String()
+}
+
+// diverges indique si une valeur s'écarte de la référence values[0] au-delà de tol ; une cohorte manquante diverge toujours.
+func diverges(values []models.ModeValues, tol Tolerance) bool {
+	ref := values[0]
+	for _, v := range values[1:] {
+		if v.Missing || ref.Missing {
+			return true
+		}
+		allowed := tol.LTV
+		if rel := models.MoneyFromFloat(tol.LTVRel * ref.LTVAvg.Abs().Float64()); rel > allowed {
+			allowed = rel
+		}
+		if (v.LTVAvg-ref.LTVAvg).Abs() > allowed ||
+			absInt(v.CohortClients-ref.CohortClients) > tol.Clients ||
+			absInt(v.EventsRead-ref.EventsRead) > tol.Events {
+			return true
+		}
+	}
+	return false
+}
+
+func absInt(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
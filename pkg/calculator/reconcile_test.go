@@ -0,0 +1,63 @@
+package calculator
+
+import (
+	"context"
+	"testing"
+
+	"ltv-monthly/pkg/models"
+)
+
+func TestReconcile(t *testing.T) {
+	src := fixtureSource()
+	src.insertDates = []models.RawEventsInsertDate{{EventID: 3, InsertDate: day(2025, 2, 10)}}
+
+	rows, err := Reconcile(context.Background(), src, fixtureConfig(), []string{ModeNormal, ModeRamOptimized, ModePushdown}, Tolerance{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rows) != 2 || rows[0].Diverges || rows[1].Diverges || len(rows[0].Values) != 3 {
+		t.Fatalf("expected agreeing modes: %+v", rows)
+	}
+
+	// le mode InsertDate déplace le client 2 de janvier à février
+	rows, err = Reconcile(context.Background(), src, fixtureConfig(), []string{ModeNormal, ModeWithInsertDate}, Tolerance{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !rows[0].Diverges || !rows[1].Diverges || rows[0].Values[1].CohortClients != 1 {
+		t.Fatalf("expected divergence: %+v", rows)
+	}
+
+	if _, err := Reconcile(context.Background(), src, fixtureConfig(), []string{ModeNormal}, Tolerance{}); err == nil {
+		t.Fatal("expected error with a single mode, got nil")
+	}
+	if _, err := Reconcile(context.Background(), src, fixtureConfig(), []string{ModeNormal, "fast"}, Tolerance{}); err == nil {
+		t.Fatal("expected error for unknown mode, got nil")
+	}
+}
+
+func TestDiverges_Tolerance(t *testing.T) {
+	values := []models.ModeValues{
+		{Mode: ModeNormal, LTVAvg: eur(100), CohortClients: 50, EventsRead: 80},
+		{Mode: ModeRamOptimized, LTVAvg: eur(101), CohortClients: 49, EventsRead: 80},
+	}
+	for _, tc := range []struct {
+		tol  Tolerance
+		want bool
+	}{
+		{Tolerance{}, true},
+		{Tolerance{LTV: eur(1), Clients: 1}, false},
+		{Tolerance{LTVRel: 0.01, Clients: 1}, false},
+		{Tolerance{LTVRel: 0.005, Clients: 1}, true},
+		{Tolerance{LTV: eur(1)}, true}, // un client d'écart
+	} {
+		if got := diverges(values, tc.tol); got != tc.want {
+			t.Fatalf("%+v: got %v, want %v", tc.tol, got, tc.want)
+		}
+	}
+
+	values[1] = models.ModeValues{Mode: ModeRamOptimized, Missing: true}
+	if !diverges(values, Tolerance{LTV: eur(1000), Clients: 1000, Events: 1000}) {
+		t.Fatal("expected a missing cohort to diverge")
+	}
+}
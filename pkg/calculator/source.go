@@ -0,0 +1,59 @@
+package calculator
+
+import (
+	"context"
+	"time"
+
+	"ltv-monthly/pkg/models"
+)
+
+// EventSource abstrait l'origine des données brutes utilisées par le calcul.
+// Les implémentations sont database.SQLSource (MySQL/MariaDB, PostgreSQL, SQLite) et
+// filesource.Source (extraits CSV, JSON Lines, Parquet) ; d'autres sources (fakes de test,
+// entrepôts) peuvent être branchées sans toucher au calcul.
+type EventSource interface {
+	// LoadOrderEvents charge tous les événements d'achat antérieurs à obsBefore.
+	LoadOrderEvents(ctx context.Context, obsBefore time.Time, cfg models.Config) ([]models.RawEventData, error)
+	// StreamOrderEvents transmet un par un à fn les événements d'achat antérieurs à obsBefore,
+	// sans les matérialiser ; une erreur de fn interrompt le parcours.
+	StreamOrderEvents(ctx context.Context, obsBefore time.Time, cfg models.Config, fn func(models.RawEventData) error) error
+	// LoadOrdersInsertDate charge les dates d'insertion des événements fournis, antérieures à obsBefore.
+	LoadOrdersInsertDate(ctx context.Context, events []models.RawEventData, obsBefore time.Time, cfg models.Config) ([]models.RawEventsInsertDate, error)
+	// LoadCohortCustomers charge les clients dont la première commande est dans [cohortStart, cohortEnd),
+	// en ne considérant que les événements antérieurs à cfg.Observation.
+	LoadCohortCustomers(ctx context.Context, cohortStart, cohortEnd time.Time, cfg models.Config) ([]models.CohortCustomer, error)
+	// LoadOrderEventsWithCustomersID charge les événements d'achat des clients fournis, antérieurs à obsBefore.
+	LoadOrderEventsWithCustomersID(ctx context.Context, customers []models.CohortCustomer, obsBefore time.Time, cfg models.Config) ([]models.RawEventData, error)
+}
+
+// CohortAggregator est implémentée par les sources capables de calculer elles-mêmes les agrégats
+// de cohortes (mode pushdown) : une ligne par période de cohorte, sans transférer les événements.
+type CohortAggregator interface {
+	// AggregateCohorts renvoie, pour chaque période (selon cfg.Granularity) contenant des premières commandes
+	// dans [cohortStart, cohortEnd), le nombre de clients et leurs sommes jusqu'à cfg.Observation.
+	AggregateCohorts(ctx context.Context, cohortStart, cohortEnd time.Time, cfg models.Config) ([]models.CohortAggregate, error)
+}
+
+// PartitionedSource est implémentée par les sources capables de découper le parcours complet des événements
+// en plages de CustomerID lisibles en parallèle (Config.Partitions, Config.LoadWorkers).
+type PartitionedSource interface {
+	// CustomerRanges découpe l'espace des CustomerID en au plus n plages disjointes.
+	CustomerRanges(ctx context.Context, n int, cfg models.Config) ([]models.CustomerRange, error)
+	// StreamOrderEventsInRange transmet à fn les événements d'achat antérieurs à obsBefore des clients de r.
+	StreamOrderEventsInRange(ctx context.Context, r models.CustomerRange, obsBefore time.Time, cfg models.Config, fn func(models.RawEventData) error) error
+}
+
+// CustomerEventStreamer est implémentée par les sources capables de transmettre au fil de l'eau les événements
+// d'une liste de clients : RunRamOptimized les agrège sans matérialiser la liste des événements.
+type CustomerEventStreamer interface {
+	// StreamOrderEventsWithCustomersID transmet à fn les événements d'achat des clients fournis, antérieurs à obsBefore.
+	StreamOrderEventsWithCustomersID(ctx context.Context, customers []models.CohortCustomer, obsBefore time.Time, cfg models.Config, fn func(models.RawEventData) error) error
+}
+
+// InsertDateStreamer est implémentée par les sources capables de transmettre au fil de l'eau les événements
+// déjà datés par leur date d'insertion : le mode withInsertDate les agrège sans les matérialiser.
+type InsertDateStreamer interface {
+	// StreamOrderEventsWithInsertDate transmet à fn les événements d'achat antérieurs à obsBefore, dont EventDate
+	// est remplacée par leur plus ancienne InsertDate antérieure à obsBefore si elle existe.
+	StreamOrderEventsWithInsertDate(ctx context.Context, obsBefore time.Time, cfg models.Config, fn func(models.RawEventData) error) error
+}
@@ -0,0 +1,434 @@
+package calculator
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"ltv-monthly/pkg/fx"
+	"ltv-monthly/pkg/models"
+)
+
+// fakeSource est une EventSource en mémoire pour tester le calcul sans base de données.
+type fakeSource struct {
+	events       []models.RawEventData
+	insertDates  []models.RawEventsInsertDate
+	loadCalls    int   // nombre d'appels à LoadOrderEvents (chargement matérialisé)
+	windowEvents int   // événements transmis par StreamOrderEventsBetween (calcul incrémental)
+	rangeErr     error // erreur renvoyée par StreamOrderEventsInRange hors de la première plage
+}
+
+func (f *fakeSource) LoadOrderEvents(ctx context.Context, obsBefore time.Time, cfg models.Config) ([]models.RawEventData, error) {
+	f.loadCalls++
+	out := make([]models.RawEventData, 0, len(f.events))
+	for _, ev := range f.events {
+		if ev.EventDate.Before(obsBefore) {
+			out = append(out, ev)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeSource) StreamOrderEvents(ctx context.Context, obsBefore time.Time, cfg models.Config, fn func(models.RawEventData) error) error {
+	for _, ev := range f.events {
+		if !ev.EventDate.Before(obsBefore) {
+			continue
+		}
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeSource) LoadOrdersInsertDate(ctx context.Context, events []models.RawEventData, obsBefore time.Time, cfg models.Config) ([]models.RawEventsInsertDate, error) {
+	out := make([]models.RawEventsInsertDate, 0, len(f.insertDates))
+	for _, x := range f.insertDates {
+		if x.InsertDate.Before(obsBefore) {
+			out = append(out, x)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeSource) LoadCohortCustomers(ctx context.Context, cohortStart, cohortEnd time.Time, cfg models.Config) ([]models.CohortCustomer, error) {
+	if cfg.Observation.Before(cohortEnd) {
+		cohortEnd = cfg.Observation
+	}
+	first := make(map[uint64]time.Time)
+	for _, ev := range f.events {
+		// comme la requête SQL, seuls les achats (type 6, ou non renseigné) définissent la première commande
+		if !ev.EventDate.Before(cohortEnd) || (ev.EventTypeID != 0 && ev.EventTypeID != 6) {
+			continue
+		}
+		if t0, ok := first[ev.CustomerID]; !ok || ev.EventDate.Before(t0) {
+			first[ev.CustomerID] = ev.EventDate
+		}
+	}
+	var out []models.CohortCustomer
+	for cid, t := range first {
+		if !t.Before(cohortStart) {
+			out = append(out, models.CohortCustomer{CustomerID: cid, FirstOrderDT: t})
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeSource) LoadOrderEventsWithCustomersID(ctx context.Context, customers []models.CohortCustomer, obsBefore time.Time, cfg models.Config) ([]models.RawEventData, error) {
+	ids := make(map[uint64]struct{}, len(customers))
+	for _, c := range customers {
+		ids[c.CustomerID] = struct{}{}
+	}
+	var out []models.RawEventData
+	for _, ev := range f.events {
+		if _, ok := ids[ev.CustomerID]; ok && ev.EventDate.Before(obsBefore) {
+			out = append(out, ev)
+		}
+	}
+	return out, nil
+}
+
+func day(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// eur convertit un montant entier en models.Money.
+func eur(units int64) models.Money {
+	return models.MoneyFromFloat(float64(units))
+}
+
+func fixtureSource() *fakeSource {
+	return &fakeSource{events: []models.RawEventData{
+		{EventID: 1, CustomerID: 1, EventDate: day(2025, 1, 5), Quantity: 1, UnitPrice: eur(10)},
+		{EventID: 2, CustomerID: 1, EventDate: day(2025, 2, 5), Quantity: 2, UnitPrice: eur(5)},
+		{EventID: 3, CustomerID: 2, EventDate: day(2025, 1, 20), Quantity: 1, UnitPrice: eur(30)},
+		{EventID: 4, CustomerID: 3, EventDate: day(2025, 2, 1), Quantity: 1, UnitPrice: eur(7)},
+		{EventID: 5, CustomerID: 3, EventDate: day(2025, 4, 1), Quantity: 1, UnitPrice: eur(100)}, // après Observation
+	}}
+}
+
+func fixtureConfig() models.Config {
+	return models.Config{
+		StartMonthInclusive: "012025",
+		EndMonthInclusive:   "022025",
+		Observation:         day(2025, 3, 1),
+	}
+}
+
+func TestRun_FakeSource(t *testing.T) {
+	got, err := Run(context.Background(), fixtureSource(), fixtureConfig())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d results, want 2", len(got))
+	}
+	// 01/2025: clients 1 (10+10) et 2 (30) → 50/2
+	if got[0].MonthYear != "01/2025" || got[0].CohortClients != 2 || got[0].EventsRead != 3 || got[0].LTVAvg != eur(25) {
+		t.Fatalf("unexpected 01/2025 result: %+v", got[0])
+	}
+	// 02/2025: client 3 (7), l'achat d'avril est exclu
+	if got[1].MonthYear != "02/2025" || got[1].CohortClients != 1 || got[1].EventsRead != 1 || got[1].LTVAvg != eur(7) {
+		t.Fatalf("unexpected 02/2025 result: %+v", got[1])
+	}
+}
+
+func TestRun_StreamsEvents(t *testing.T) {
+	src := fixtureSource()
+	if _, err := Run(context.Background(), src, fixtureConfig()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if src.loadCalls != 0 {
+		t.Fatalf("Run materialized events (%d LoadOrderEvents calls), want streaming", src.loadCalls)
+	}
+}
+
+func TestRunRamOptimized_MatchesRun(t *testing.T) {
+	src := fixtureSource()
+	want, err := Run(context.Background(), src, fixtureConfig())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	got, err := RunRamOptimized(context.Background(), src, fixtureConfig())
+	if err != nil {
+		t.Fatalf("RunRamOptimized: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d results, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Fatalf("row %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestRunWithInsertDate_ReassignsCohort(t *testing.T) {
+	src := fixtureSource()
+	// l'achat unique du client 2 a été inséré en février → il change de cohorte
+	src.insertDates = []models.RawEventsInsertDate{{EventID: 3, InsertDate: day(2025, 2, 10)}}
+	got, err := RunWithInsertDateFromCustomerEvent(context.Background(), src, fixtureConfig())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got[0].CohortClients != 1 || got[1].CohortClients != 2 {
+		t.Fatalf("unexpected cohorts: %+v", got)
+	}
+}
+
+func TestRunTriangle(t *testing.T) {
+	got, err := RunTriangle(context.Background(), fixtureSource(), fixtureConfig())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d rows, want 2", len(got))
+	}
+	// 01/2025 : M0 = (10+30)/2, M1 = (10+30+10)/2
+	jan := got[0]
+	if jan.CohortClients != 2 || len(jan.CumulativeLTV) != 2 || jan.CumulativeLTV[0] != eur(20) || jan.CumulativeLTV[1] != eur(25) {
+		t.Fatalf("unexpected 01/2025 row: %+v", jan)
+	}
+	// 02/2025 : une seule colonne avant Observation
+	feb := got[1]
+	if feb.CohortClients != 1 || len(feb.CumulativeLTV) != 1 || feb.CumulativeLTV[0] != eur(7) {
+		t.Fatalf("unexpected 02/2025 row: %+v", feb)
+	}
+}
+
+func TestRunRamOptimized_ObservationInsideRange(t *testing.T) {
+	cfg := fixtureConfig()
+	cfg.Observation = day(2025, 2, 1) // février exclu : le client 3 ne doit pas apparaître
+	got, err := RunRamOptimized(context.Background(), fixtureSource(), cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got[0].CohortClients != 2 || got[0].LTVAvg != eur(20) || got[1].CohortClients != 0 {
+		t.Fatalf("unexpected results: %+v", got)
+	}
+}
+
+func TestRun_NetOfRefunds(t *testing.T) {
+	src := fixtureSource()
+	src.events = append(src.events,
+		// remboursement partiel du client 2, type 7 configuré comme remboursement
+		models.RawEventData{EventID: 6, CustomerID: 2, EventTypeID: 7, EventDate: day(2025, 1, 25), Quantity: 1, UnitPrice: eur(10)},
+		// remboursement d'un client sans achat : ne crée pas de cohorte
+		models.RawEventData{EventID: 7, CustomerID: 9, EventTypeID: 7, EventDate: day(2025, 1, 2), Quantity: 1, UnitPrice: eur(50)},
+	)
+	cfg := fixtureConfig()
+	cfg.RefundEventTypeIDs = []int{7}
+
+	for name, runner := range map[string]Runner{"Run": Run, "RunRamOptimized": RunRamOptimized} {
+		got, err := runner(context.Background(), src, cfg)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		jan := got[0]
+		if jan.CohortClients != 2 || jan.LTVAvg != eur(25) || jan.RefundsAvg != eur(5) || jan.NetLTVAvg != eur(20) {
+			t.Fatalf("%s: unexpected 01/2025 result: %+v", name, jan)
+		}
+		if got[1].NetLTVAvg != got[1].LTVAvg {
+			t.Fatalf("%s: unexpected 02/2025 result: %+v", name, got[1])
+		}
+	}
+}
+
+func TestRun_AmountOverflow(t *testing.T) {
+	src := fixtureSource()
+	src.events = append(src.events,
+		models.RawEventData{EventID: 6, CustomerID: 2, EventDate: day(2025, 1, 25), Quantity: 1_000_000, UnitPrice: eur(100_000_000_000)})
+	for name, runner := range map[string]Runner{"Run": Run, "RunRamOptimized": RunRamOptimized} {
+		if _, err := runner(context.Background(), src, fixtureConfig()); err == nil {
+			t.Fatalf("%s: expected overflow error, got nil", name)
+		}
+	}
+
+	// montant valide en devise d'origine, hors limites une fois converti
+	src = fixtureSource()
+	src.events[2].Currency = "JPY"
+	src.events[2].UnitPrice = eur(9_000_000_000_000)
+	rates, err := fx.ReadCSV(strings.NewReader("2025-01-01,JPY,1000\n"), "EUR")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg := fixtureConfig()
+	cfg.Currency = rates
+	if _, err := Run(context.Background(), src, cfg); err == nil {
+		t.Fatal("conversion: expected overflow error, got nil")
+	}
+}
+
+func TestRun_CurrencyConversion(t *testing.T) {
+	src := fixtureSource()
+	src.events[0].Currency = "EUR"
+	src.events[1].Currency = "EUR"
+	src.events[2].Currency = "GBP" // 30 GBP × 1.2 = 36 EUR
+	src.events[3].Currency = "USD" // sans taux : exclu des montants, client conservé
+	rates, err := fx.ReadCSV(strings.NewReader("2025-01-01,GBP,1.2\n"), "EUR")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg := fixtureConfig()
+	cfg.Currency = rates
+
+	for name, runner := range map[string]Runner{"Run": Run, "RunRamOptimized": RunRamOptimized} {
+		got, err := runner(context.Background(), src, cfg)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if jan := got[0]; jan.CohortClients != 2 || jan.LTVAvg != eur(28) || jan.UnconvertedEvents != 0 {
+			t.Fatalf("%s: unexpected 01/2025 result: %+v", name, jan)
+		}
+		if feb := got[1]; feb.CohortClients != 1 || feb.LTVAvg != 0 || feb.EventsRead != 0 || feb.UnconvertedEvents != 1 {
+			t.Fatalf("%s: unexpected 02/2025 result: %+v", name, feb)
+		}
+	}
+}
+
+func TestRun_PredictedLTV(t *testing.T) {
+	src := fixtureSource()
+	src.events = append(src.events,
+		models.RawEventData{EventID: 8, CustomerID: 2, EventDate: day(2025, 2, 20), Quantity: 1, UnitPrice: eur(12)},
+		models.RawEventData{EventID: 9, CustomerID: 3, EventDate: day(2025, 2, 15), Quantity: 1, UnitPrice: eur(9)},
+		// client hors des cohortes demandées : chargé par Run seulement, exclu de l'ajustement dans les deux modes
+		models.RawEventData{EventID: 10, CustomerID: 4, EventDate: day(2024, 11, 3), Quantity: 1, UnitPrice: eur(80)},
+		models.RawEventData{EventID: 11, CustomerID: 4, EventDate: day(2024, 12, 8), Quantity: 2, UnitPrice: eur(60)},
+		models.RawEventData{EventID: 12, CustomerID: 4, EventDate: day(2025, 2, 26), Quantity: 1, UnitPrice: eur(75)},
+	)
+	cfg := fixtureConfig()
+	cfg.PredictHorizons = []int{6, 12, 24}
+
+	byRunner := map[string][]models.CohortResult{}
+	for name, runner := range map[string]Runner{"Run": Run, "RunRamOptimized": RunRamOptimized} {
+		got, err := runner(context.Background(), src, cfg)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		for _, r := range got {
+			if len(r.Predicted) != 3 {
+				t.Fatalf("%s: %s: got %d predictions, want 3", name, r.MonthYear, len(r.Predicted))
+			}
+			prev := r.LTVAvg
+			for i, p := range r.Predicted {
+				if p.Months != cfg.PredictHorizons[i] || p.LTVAvg < prev {
+					t.Fatalf("%s: %s: predictions must extend the historical LTV: %+v", name, r.MonthYear, r.Predicted)
+				}
+				prev = p.LTVAvg
+			}
+		}
+		byRunner[name] = got
+	}
+	if !reflect.DeepEqual(byRunner["Run"], byRunner["RunRamOptimized"]) {
+		t.Fatalf("Run and RunRamOptimized disagree:\n%+v\n%+v", byRunner["Run"], byRunner["RunRamOptimized"])
+	}
+
+	cfg.PredictHorizons = []int{12}
+	src.events = src.events[2:3] // un seul achat : aucun achat répété
+	if _, err := Run(context.Background(), src, cfg); err == nil {
+		t.Fatal("expected error without repeat purchases, got nil")
+	}
+}
+
+func TestRun_Retention(t *testing.T) {
+	cfg := fixtureConfig()
+	cfg.Retention = true
+	want := []*models.Retention{
+		{ActiveCustomers: []int{2, 1}, RetentionRate: []float64{1, 0.5}, RepeatPurchaseRate: 0.5, AvgOrders: 1.5, AvgOrderValue: 16_666_667},
+		{ActiveCustomers: []int{1}, RetentionRate: []float64{1}, RepeatPurchaseRate: 0, AvgOrders: 1, AvgOrderValue: eur(7)},
+	}
+	for name, runner := range map[string]Runner{"Run": Run, "RunRamOptimized": RunRamOptimized} {
+		got, err := runner(context.Background(), fixtureSource(), cfg)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		for i, r := range got {
+			if !reflect.DeepEqual(r.Retention, want[i]) {
+				t.Fatalf("%s: %s: got %+v, want %+v", name, r.MonthYear, r.Retention, want[i])
+			}
+		}
+	}
+}
+
+func TestRun_SegmentByFirstPurchase(t *testing.T) {
+	src := fixtureSource()
+	src.events[0].Segments = []string{"web"}   // client 1, première commande
+	src.events[1].Segments = []string{"store"} // client 1, commande suivante : ignorée
+	src.events[2].Segments = []string{"store"} // client 2
+	src.events[3].Segments = []string{"web"}   // client 3
+	cfg := fixtureConfig()
+	cfg.SegmentBy = []string{"$.channel"}
+
+	for name, runner := range map[string]Runner{"Run": Run, "RunRamOptimized": RunRamOptimized} {
+		got, err := runner(context.Background(), src, cfg)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if len(got) != 3 {
+			t.Fatalf("%s: got %d rows, want 3: %+v", name, len(got), got)
+		}
+		// 01/2025 : store (client 2) puis web (client 1), triés par segment
+		if got[0].Segments["$.channel"] != "store" || got[0].LTVAvg != eur(30) ||
+			got[1].Segments["$.channel"] != "web" || got[1].LTVAvg != eur(20) ||
+			got[2].MonthYear != "02/2025" || got[2].Segments["$.channel"] != "web" {
+			t.Fatalf("%s: unexpected rows: %+v", name, got)
+		}
+	}
+}
+
+func (f *fakeSource) CustomerRanges(ctx context.Context, n int, cfg models.Config) ([]models.CustomerRange, error) {
+	// plages de 2 IDs : 1-2, 3-4, ... bornées à n plages
+	var out []models.CustomerRange
+	for from := uint64(1); len(out) < n; from += 2 {
+		out = append(out, models.CustomerRange{From: from, To: from + 1})
+	}
+	out[n-1].To = ^uint64(0)
+	return out, nil
+}
+
+func (f *fakeSource) StreamOrderEventsInRange(ctx context.Context, r models.CustomerRange, obsBefore time.Time, cfg models.Config, fn func(models.RawEventData) error) error {
+	if f.rangeErr != nil && r.From > 1 {
+		return f.rangeErr
+	}
+	for _, ev := range f.events {
+		if ev.CustomerID < r.From || ev.CustomerID > r.To || !ev.EventDate.Before(obsBefore) {
+			continue
+		}
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestRun_Partitioned(t *testing.T) {
+	src := fixtureSource()
+	src.events = append(src.events,
+		models.RawEventData{EventID: 6, CustomerID: 2, EventTypeID: 7, EventDate: day(2025, 1, 25), Quantity: 1, UnitPrice: eur(10)},
+		models.RawEventData{EventID: 7, CustomerID: 5, EventDate: day(2025, 2, 3), Quantity: 2, UnitPrice: eur(4)},
+	)
+	cfg := fixtureConfig()
+	cfg.RefundEventTypeIDs = []int{7}
+	cfg.Distribution = true
+	want, err := Run(context.Background(), src, cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cfg.Partitions, cfg.LoadWorkers = 3, 2
+	got, err := Run(context.Background(), src, cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("partitioned run differs:\n got %+v\nwant %+v", got, want)
+	}
+
+	src.rangeErr = errors.New("connection lost")
+	if _, err := Run(context.Background(), src, cfg); !errors.Is(err, src.rangeErr) {
+		t.Fatalf("got %v, want the partition error", err)
+	}
+}
@@ -0,0 +1,81 @@
+package calculator
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"ltv-monthly/pkg/models"
+)
+
+// RunTriangle calcule le triangle de cohortes : pour chaque période de cohorte, le revenu
+// cumulé par client à M0, M1, M2… (périodes depuis la première commande) jusqu'à Observation.
+// Contrairement à LTVAvg, chaque colonne compare des cohortes au même âge.
+func RunTriangle(ctx context.Context, src EventSource, cfg models.Config) ([]models.CohortTriangle, error) {
+	cfg = normalizeConfig(cfg)
+	periods, g, err := ParsePeriod(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Verbose {
+		log.Printf("[INFO] [STEP] Load events < Observation=%s", cfg.Observation.Format(time.RFC3339))
+	}
+
+	// 1) agrégation au fil de l'eau, avec le revenu de chaque client par période
+	agg, err := aggregateEvents(ctx, src, cfg, false, tracking{periods: true})
+	if err != nil {
+		return nil, err
+	}
+	agg.logUnconverted()
+
+	// 2) revenu par (cohorte, âge) et nombre de clients par cohorte
+	clientsByPeriod := make(map[string]int, len(periods))
+	revenueByAge := make(map[string][]models.Money, len(periods))
+	for _, c := range agg.customers {
+		if c.First.IsZero() {
+			continue // remboursements sans achat dans la période observée
+		}
+		key := g.label(c.First)
+		clientsByPeriod[key]++
+		row := revenueByAge[key]
+		for pi, amount := range c.RevenueByPeriod {
+			age := pi - g.index(c.First)
+			for len(row) <= age {
+				row = append(row, 0)
+			}
+			row[age] += amount
+		}
+		revenueByAge[key] = row
+	}
+
+	// 3) cumul et moyenne par client, borné à l'âge atteint à Observation
+	results := make([]models.CohortTriangle, 0, len(periods))
+	for _, p := range periods {
+		key := g.label(p)
+		clients := clientsByPeriod[key]
+		ages := g.ages(p, cfg.Observation)
+
+		cum := make([]models.Money, ages)
+		var total models.Money
+		row := revenueByAge[key]
+		for k := 0; k < ages; k++ {
+			if k < len(row) {
+				total += row[k]
+			}
+			cum[k] = total.Div(clients, cfg.Rounding)
+		}
+
+		results = append(results, models.CohortTriangle{
+			MonthYear:     key,
+			CohortClients: clients,
+			CumulativeLTV: cum,
+		})
+
+		if cfg.Verbose {
+			log.Printf("[INFO] %s -> clients=%d | ages=%d", key, clients, ages)
+		}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,241 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/stdlib"
+	"modernc.org/sqlite"
+)
+
+// dialect identifie le SQL parlé par une base : placeholders, extraction JSON, troncature de dates,
+// types des tables créées et upserts. Les requêtes sont écrites avec des placeholders "?" et des
+// dates passées en texte UTC "YYYY-MM-DD HH:MM:SS", communs aux trois dialectes.
+type dialect string
+
+const (
+	dialectMySQL    dialect = "mysql"
+	dialectPostgres dialect = "postgres"
+	dialectSQLite   dialect = "sqlite"
+)
+
+// dialectOf déduit le dialecte du driver du pool db (voir Open) ; MySQL/MariaDB par défaut.
+func dialectOf(db *sql.DB) dialect {
+	switch db.Driver().(type) {
+	case *stdlib.Driver:
+		return dialectPostgres
+	case *sqlite.Driver:
+		return dialectSQLite
+	}
+	return dialectMySQL
+}
+
+// rebind convertit les placeholders "?" de q en "$1", "$2", ... pour PostgreSQL ;
+// les "?" des littéraux entre apostrophes sont conservés.
+func (d dialect) rebind(q string) string {
+	if d != dialectPostgres {
+		return q
+	}
+	var b strings.Builder
+	b.Grow(len(q) + 16)
+	n, quoted := 0, false
+	for i := 0; i < len(q); i++ {
+		switch c := q[i]; {
+		case c == '\'':
+			quoted = !quoted
+			b.WriteByte(c)
+		case c == '?' && !quoted:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// table renvoie le nom de table à insérer dans une requête (validé par identRe) : entre accents graves
+// pour MySQL, tel quel ailleurs (PostgreSQL le replie en minuscules, à la création comme à la lecture).
+func (d dialect) table(name string) string {
+	if d == dialectMySQL {
+		return "`" + name + "`"
+	}
+	return name
+}
+
+// jsonText renvoie l'expression texte de la valeur du chemin path (validé par jsonPathRe) dans la
+// colonne JSON col, comme JSON_UNQUOTE(JSON_EXTRACT(...)) : NULL si le chemin n'existe pas.
+func (d dialect) jsonText(col, path string) string {
+	switch d {
+	case dialectPostgres:
+		return fmt.Sprintf("(%s::jsonb #>> '%s')", col, pgPath(path))
+	case dialectSQLite:
+		return fmt.Sprintf("CAST(json_extract(%s, '%s') AS TEXT)", col, path)
+	}
+	return fmt.Sprintf("JSON_UNQUOTE(JSON_EXTRACT(%s, '%s'))", col, path)
+}
+
+// jsonDecimal renvoie l'expression numérique de la valeur du chemin path dans col, comme
+// CAST(JSON_EXTRACT(...) AS DECIMAL(18,6)) ; une valeur non numérique vaut 0 ou NULL selon la base.
+func (d dialect) jsonDecimal(col, path string) string {
+	switch d {
+	case dialectPostgres:
+		text := d.jsonText(col, path)
+		return fmt.Sprintf(`(CASE WHEN %[1]s ~ '^\s*[-+]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][-+]?[0-9]+)?\s*$'
+				THEN CAST(%[1]s AS NUMERIC(18,6)) END)`, text)
+	case dialectSQLite:
+		return fmt.Sprintf("CAST(json_extract(%s, '%s') AS NUMERIC)", col, path)
+	}
+	return fmt.Sprintf("CAST(JSON_EXTRACT(%s, '%s') AS DECIMAL(18,6))", col, path)
+}
+
+// pgPath convertit un chemin "$.a.b[0]" (validé par jsonPathRe) en chemin PostgreSQL "{a,b,0}".
+func pgPath(path string) string {
+	r := strings.NewReplacer("[", ".", "]", "")
+	return "{" + strings.ReplaceAll(strings.TrimPrefix(r.Replace(strings.TrimPrefix(path, "$")), "."), ".", ",") + "}"
+}
+
+// cohortStart renvoie l'expression SQL du début de période (UTC) contenant col, selon la granularité.
+func (d dialect) cohortStart(granularity, col string) (string, error) {
+	switch granularity {
+	case "day", "week", "month", "", "quarter", "year":
+	default:
+		return "", fmt.Errorf("granularité inconnue %q", granularity)
+	}
+	if granularity == "" {
+		granularity = "month"
+	}
+	switch d {
+	case dialectPostgres: // date_trunc('week') : lundi de la semaine ISO
+		return fmt.Sprintf("CAST(date_trunc('%s', %s) AS DATE)", granularity, col), nil
+	case dialectSQLite:
+		switch granularity {
+		case "day":
+			return fmt.Sprintf("date(%s)", col), nil
+		case "week": // strftime('%w') : 0 = dimanche
+			return fmt.Sprintf("date(%[1]s, '-' || ((CAST(strftime('%%w', %[1]s) AS INTEGER) + 6) %% 7) || ' days')", col), nil
+		case "month":
+			return fmt.Sprintf("strftime('%%Y-%%m-01', %s)", col), nil
+		case "quarter":
+			return fmt.Sprintf("printf('%%s-%%02d-01', strftime('%%Y', %[1]s), (CAST(strftime('%%m', %[1]s) AS INTEGER) - 1) / 3 * 3 + 1)", col), nil
+		}
+		return fmt.Sprintf("strftime('%%Y-01-01', %s)", col), nil
+	}
+	switch granularity {
+	case "day":
+		return fmt.Sprintf("DATE(%s)", col), nil
+	case "week": // lundi de la semaine ISO
+		return fmt.Sprintf("DATE_SUB(DATE(%[1]s), INTERVAL WEEKDAY(%[1]s) DAY)", col), nil
+	case "month":
+		return fmt.Sprintf("DATE(DATE_FORMAT(%s, '%%Y-%%m-01'))", col), nil
+	case "quarter":
+		return fmt.Sprintf("MAKEDATE(YEAR(%[1]s), 1) + INTERVAL (QUARTER(%[1]s) - 1) QUARTER", col), nil
+	}
+	return fmt.Sprintf("MAKEDATE(YEAR(%s), 1)", col), nil
+}
+
+// Types des colonnes des tables créées par l'outil (résultats, état, événements de test).
+func (d dialect) datetimeType() string {
+	if d == dialectPostgres {
+		return "TIMESTAMP"
+	}
+	return "DATETIME"
+}
+
+func (d dialect) uint64Type() string {
+	if d == dialectMySQL {
+		return "BIGINT UNSIGNED"
+	}
+	return "BIGINT"
+}
+
+func (d dialect) smallintType() string {
+	if d == dialectMySQL {
+		return "TINYINT"
+	}
+	return "SMALLINT"
+}
+
+func (d dialect) jsonType() string {
+	switch d {
+	case dialectMySQL:
+		return "JSON"
+	case dialectPostgres:
+		return "JSONB"
+	}
+	return "TEXT"
+}
+
+// textCast renvoie le type cible d'un CAST en texte.
+func (d dialect) textCast() string {
+	if d == dialectMySQL {
+		return "CHAR"
+	}
+	return "TEXT"
+}
+
+// upsert renvoie la clause qui remplace les colonnes cols d'une ligne existante de même clé keys.
+func (d dialect) upsert(keys, cols []string) string {
+	set := make([]string, len(cols))
+	if d == dialectMySQL {
+		for i, c := range cols {
+			set[i] = fmt.Sprintf("%s = VALUES(%s)", c, c)
+		}
+		return "ON DUPLICATE KEY UPDATE " + strings.Join(set, ", ")
+	}
+	for i, c := range cols {
+		set[i] = fmt.Sprintf("%s = excluded.%s", c, c)
+	}
+	return fmt.Sprintf("ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(keys, ", "), strings.Join(set, ", "))
+}
+
+// columnsQuery renvoie la requête listant les colonnes d'une table (paramètre : nom de la table).
+func (d dialect) columnsQuery() string {
+	switch d {
+	case dialectPostgres:
+		return `
+			SELECT column_name
+			FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = lower(?)`
+	case dialectSQLite:
+		return "SELECT name FROM pragma_table_info(?)"
+	}
+	return `
+			SELECT COLUMN_NAME
+			FROM INFORMATION_SCHEMA.COLUMNS
+			WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?`
+}
+
+// dbTime lit une date renvoyée par le driver dans *t, en UTC : time.Time (MySQL avec parseTime,
+// PostgreSQL, colonnes DATETIME SQLite) ou texte (SQLite : agrégats, expressions, colonnes TEXT).
+// NULL donne la date zéro.
+type dbTime struct{ t *time.Time }
+
+// textDateLayouts : formats des dates lues en texte (celui écrit par le driver SQLite en premier).
+var textDateLayouts = []string{"2006-01-02 15:04:05.999999999-07:00", "2006-01-02 15:04:05.999999999", time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02"}
+
+func (s dbTime) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*s.t = time.Time{}
+		return nil
+	case time.Time:
+		*s.t = v.UTC()
+		return nil
+	case []byte:
+		return s.Scan(string(v))
+	case string:
+		for _, layout := range textDateLayouts {
+			if t, err := time.ParseInLocation(layout, v, time.UTC); err == nil {
+				*s.t = t.UTC()
+				return nil
+			}
+		}
+		return fmt.Errorf("date invalide %q", v)
+	}
+	return fmt.Errorf("date: type non supporté %T", src)
+}
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"ltv-monthly/pkg/models"
+)
+
+// eventInsertBatch : nombre d'événements par INSERT multi-lignes lors de l'écriture d'événements.
+const eventInsertBatch = 500
+
+// InsertEvents écrit events dans les tables d'événements du mapping s (CustomerEventData et
+// CustomerEvent pour la date d'insertion), dans une seule transaction, par INSERT multi-lignes.
+func InsertEvents(ctx context.Context, db *sql.DB, s models.Schema, events []models.EventRecord) error {
+	if err := CheckSchema(s); err != nil {
+		return err
+	}
+	s = ResolveSchema(s)
+	d := dialectOf(db)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	const layout = "2006-01-02 15:04:05"
+	for start := 0; start < len(events); start += eventInsertBatch {
+		batch := events[start:min(start+eventInsertBatch, len(events))]
+		data := make([]any, 0, len(batch)*6)
+		inserts := make([]any, 0, len(batch)*2)
+		for _, e := range batch {
+			data = append(data, e.EventID, e.CustomerID, e.EventTypeID, e.EventDate.UTC().Format(layout), e.Quantity, e.Digest)
+			inserts = append(inserts, e.EventID, e.InsertDate.UTC().Format(layout))
+		}
+		q := fmt.Sprintf("INSERT INTO %s (EventID, CustomerID, EventTypeID, EventDate, Quantity, Digest) VALUES %s",
+			d.table(s.EventDataTable), strings.TrimRight(strings.Repeat("(?, ?, ?, ?, ?, ?),", len(batch)), ","))
+		if _, err := tx.ExecContext(ctx, d.rebind(q), data...); err != nil {
+			return fmt.Errorf("insert %s: %w", s.EventDataTable, err)
+		}
+		q = fmt.Sprintf("INSERT INTO %s (EventID, InsertDate) VALUES %s",
+			d.table(s.EventTable), strings.TrimRight(strings.Repeat("(?, ?),", len(batch)), ","))
+		if _, err := tx.ExecContext(ctx, d.rebind(q), inserts...); err != nil {
+			return fmt.Errorf("insert %s: %w", s.EventTable, err)
+		}
+	}
+	return tx.Commit()
+}
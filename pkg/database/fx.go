@@ -0,0 +1,46 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"ltv-monthly/pkg/fx"
+)
+
+// LoadFXRates charge la table de taux de change table (RateDate DATE, Currency CHAR(3), Rate DECIMAL)
+// vers la devise de reporting : Rate = unités de reporting pour 1 unité de Currency à partir de RateDate.
+func LoadFXRates(ctx context.Context, db *sql.DB, table, reporting string) (*fx.Table, error) {
+	if !identRe.MatchString(table) {
+		return nil, fmt.Errorf("fx: nom de table invalide %q", table)
+	}
+	t, err := fx.NewTable(reporting)
+	if err != nil {
+		return nil, err
+	}
+
+	// Rate lu en texte pour conserver toutes ses décimales
+	d := dialectOf(db)
+	q := fmt.Sprintf("SELECT RateDate, Currency, CAST(Rate AS %s) FROM %s ORDER BY RateDate", d.textCast(), d.table(table))
+	rows, err := db.QueryContext(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("fx: lecture %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			day      time.Time
+			currency string
+			rate     string
+		)
+		if err := rows.Scan(dbTime{&day}, &currency, &rate); err != nil {
+			return nil, err
+		}
+		if err := t.Add(currency, day, rate); err != nil {
+			return nil, fmt.Errorf("%s: %w", table, err)
+		}
+	}
+	return t, rows.Err()
+}
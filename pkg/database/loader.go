@@ -7,33 +7,71 @@ import (
 	"log"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"ltv-monthly/pkg/models"
+	"ltv-monthly/pkg/parallel"
 
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
 )
 
-const orderEventTypeID = 6 // "Purchase"
+// eventTypesFilter renvoie les placeholders et arguments du filtre EventTypeID IN (...) :
+// les achats, plus les types de remboursement/annulation configurés dans cfg.RefundEventTypeIDs.
+func eventTypesFilter(cfg models.Config) (string, []any) {
+	purchase := ResolveSchema(cfg.Schema).PurchaseEventTypeID
+	args := []any{purchase}
+	for _, id := range cfg.RefundEventTypeIDs {
+		if id != purchase {
+			args = append(args, id)
+		}
+	}
+	return strings.TrimRight(strings.Repeat("?,", len(args)), ","), args
+}
+
+// defaultChunkSize : nombre d'IDs par requête IN (...) lorsque cfg.ChunkSize n'est pas renseigné.
+const defaultChunkSize = 1000
 
 /*
-Open() : DSN en variable d'env possible, typé MySQL, loc=UTC
+Open() : DSN en variable d'env possible ; le driver (et le dialecte SQL) suit le schéma de l'URL :
+postgres:// ou postgresql:// (PostgreSQL), sqlite:// (fichier SQLite, ou sqlite://:memory:),
+sinon MySQL/MariaDB (mariadb://, mysql:// ou DSN du driver). Les dates sont en UTC.
 */
 func Open(dsn string) (*sql.DB, string, error) {
-	mysqlDSN, err := toMySQLDSN(dsn)
+	driver, conn := "mysql", ""
+	var err error
+	switch {
+	case strings.HasPrefix(dsn, "postgres://"), strings.HasPrefix(dsn, "postgresql://"):
+		driver = "pgx"
+		conn, err = toPostgresDSN(dsn)
+	case strings.HasPrefix(dsn, "sqlite://"):
+		driver = "sqlite"
+		conn, err = toSQLiteDSN(dsn)
+	default:
+		conn, err = toMySQLDSN(dsn)
+	}
 	if err != nil {
 		return nil, "", err
 	}
-	db, err := sql.Open("mysql", mysqlDSN)
+	db, err := sql.Open(driver, conn)
 	if err != nil {
 		return nil, "", err
 	}
 
 	// Configuration du pool de connexions.
+	if driver == "sqlite" {
+		// une seule connexion, jamais recyclée : pas de verrou d'écriture concurrent, et une base
+		// :memory: (propre à chaque connexion) survit pendant toute l'exécution
+		db.SetMaxOpenConns(1)
+		db.SetMaxIdleConns(1)
+		return db, conn, nil
+	}
 	db.SetMaxOpenConns(10)
 	db.SetMaxIdleConns(10)
 	db.SetConnMaxLifetime(30 * time.Minute)
-	return db, mysqlDSN, nil
+	return db, conn, nil
 }
 
 // toMySQLDSN convertit une URL de type mariadb:// ou mysql:// en une chaîne DSN standard
@@ -63,56 +101,156 @@ func toMySQLDSN(dsn string) (string, error) {
 	return dsn, nil
 }
 
+// toPostgresDSN valide une URL postgres:// et force timezone=UTC (sauf si précisé) pour la
+// cohérence des dates comparées et tronquées par la base.
+func toPostgresDSN(dsn string) (string, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", fmt.Errorf("parse dsn: %w", err)
+	}
+	if u.Host == "" || strings.TrimPrefix(u.Path, "/") == "" {
+		return "", fmt.Errorf("dsn incomplet (host/db)")
+	}
+	q := u.Query()
+	if q.Get("timezone") == "" {
+		q.Set("timezone", "UTC")
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// toSQLiteDSN convertit sqlite://chemin (relatif, ou absolu avec sqlite:///chemin) en DSN du driver ;
+// les dates sont écrites au format texte SQLite ("YYYY-MM-DD HH:MM:SS..."), comparable à nos bornes.
+func toSQLiteDSN(dsn string) (string, error) {
+	path, query, _ := strings.Cut(strings.TrimPrefix(dsn, "sqlite://"), "?")
+	if path == "" {
+		return "", fmt.Errorf("dsn incomplet (chemin de la base SQLite)")
+	}
+	q, err := url.ParseQuery(query)
+	if err != nil {
+		return "", fmt.Errorf("parse dsn: %w", err)
+	}
+	if q.Get("_time_format") == "" {
+		q.Set("_time_format", "sqlite")
+	}
+	if len(q["_pragma"]) == 0 {
+		q.Add("_pragma", "busy_timeout(5000)")
+	}
+	return path + "?" + q.Encode(), nil
+}
+
 // LoadOrderEvents charge tous les événements de commande avant la date d'observation.
 // Cette fonction est utilisée dans la première version (Run) qui charge tout en mémoire.
+// Avec cfg.Partitions > 1, les plages de CustomerID sont lues en parallèle (voir loadOrderEventsPartitioned).
 func LoadOrderEvents(ctx context.Context, db *sql.DB, obsBefore time.Time, cfg models.Config) ([]models.RawEventData, error) {
-	const table = "CustomerEventData"
+	if cfg.Partitions > 1 {
+		return loadOrderEventsPartitioned(ctx, db, obsBefore, cfg)
+	}
+	out := make([]models.RawEventData, 0, 1024)
+	err := StreamOrderEvents(ctx, db, obsBefore, cfg, func(ev models.RawEventData) error {
+		out = append(out, ev)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// StreamOrderEvents parcourt tous les événements de commande avant la date d'observation
+// et les transmet un par un à fn, sans les matérialiser en mémoire.
+// Une erreur renvoyée par fn interrompt le parcours et est propagée telle quelle.
+func StreamOrderEvents(ctx context.Context, db *sql.DB, obsBefore time.Time, cfg models.Config, fn func(models.RawEventData) error) error {
+	return StreamOrderEventsBetween(ctx, db, time.Time{}, obsBefore, cfg, fn)
+}
+
+// StreamOrderEventsBetween parcourt comme StreamOrderEvents les événements de commande
+// dont EventDate est dans [from, to) ; un from nul n'impose pas de borne basse (calcul incrémental).
+func StreamOrderEventsBetween(ctx context.Context, db *sql.DB, from, to time.Time, cfg models.Config, fn func(models.RawEventData) error) error {
+	n, err := streamOrderEvents(ctx, db, from, to, nil, cfg, fn)
+	if err != nil {
+		return err
+	}
+	if cfg.Verbose {
+		log.Printf("[INFO] [LOAD] events: %d", n)
+	}
+	return nil
+}
+
+// streamOrderEvents exécute la requête des événements de commande dont EventDate est dans [from, to)
+// (from nul : pas de borne basse), restreinte à la plage ids si elle est fournie, et renvoie le nombre d'événements transmis.
+func streamOrderEvents(ctx context.Context, db *sql.DB, from, to time.Time, ids *models.CustomerRange, cfg models.Config, fn func(models.RawEventData) error) (int, error) {
+	table := ResolveSchema(cfg.Schema).EventDataTable
+	d := dialectOf(db)
 
 	const layout = "2006-01-02 15:04:05"
-	pObs := obsBefore.Format(layout)
+	cols, err := orderEventColumns(d, cfg)
+	if err != nil {
+		return 0, err
+	}
+	types, args := eventTypesFilter(cfg)
 	q := fmt.Sprintf(`
-		SELECT
-			ced.EventID,
-			ced.CustomerID,
-			ced.EventDate,
-			COALESCE(ced.Quantity, 1) AS qty,
-			CAST(JSON_EXTRACT(ced.Digest, '$.price.originalUnitPrice') AS DECIMAL(18,6)) AS unit_price
+		SELECT %s
 		FROM %s ced
-		WHERE ced.EventTypeID = ?
+		WHERE ced.EventTypeID IN (%s)
 		  AND ced.EventDate < ?
-	`, table)
+	`, cols, table, types)
+	args = append(args, to.Format(layout))
+	if !from.IsZero() {
+		q += "  AND ced.EventDate >= ?\n"
+		args = append(args, from.Format(layout))
+	}
+	if ids != nil {
+		q += "  AND ced.CustomerID BETWEEN ? AND ?\n"
+		args = append(args, ids.From, ids.To)
+	}
 
-	rows, err := db.QueryContext(ctx, q, orderEventTypeID, pObs)
+	rows, err := db.QueryContext(ctx, d.rebind(q), args...)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 	defer rows.Close()
 
-	out := make([]models.RawEventData, 0, 1024)
 	var n int
 	for rows.Next() {
-		var ev models.RawEventData
-		if err := rows.Scan(&ev.EventID, &ev.CustomerID, &ev.EventDate, &ev.Quantity, &ev.UnitPrice); err != nil {
-			return nil, err
+		ev, err := scanOrderEvent(rows, cfg)
+		if err != nil {
+			return n, err
+		}
+		if err := fn(ev); err != nil {
+			return n, err
 		}
-		out = append(out, ev)
 		n++
 	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
+	return n, rows.Err()
+}
 
-	if cfg.Verbose {
-		log.Printf("[INFO] [LOAD] events: %d", n)
+// CountOrderEvents compte les événements de commande (achats et remboursements) antérieurs à before :
+// c'est le nombre d'événements que StreamOrderEvents transmettrait pour cette observation.
+func CountOrderEvents(ctx context.Context, db *sql.DB, before time.Time, cfg models.Config) (int, error) {
+	table := ResolveSchema(cfg.Schema).EventDataTable
+	types, args := eventTypesFilter(cfg)
+	q := fmt.Sprintf(`
+		SELECT COUNT(*)
+		FROM %s ced
+		WHERE ced.EventTypeID IN (%s)
+		  AND ced.EventDate < ?
+	`, table, types)
+	args = append(args, before.Format("2006-01-02 15:04:05"))
+
+	var n int
+	if err := db.QueryRowContext(ctx, dialectOf(db).rebind(q), args...).Scan(&n); err != nil {
+		return 0, err
 	}
-	return out, nil
+	return n, nil
 }
 
 // LoadOrderEvents charge tous les événements de commande avant la date d'observation.
 // Cette fonction est utilisée dans la première version (Run) qui charge tout en mémoire.
 func LoadOrdersInsertDate(ctx context.Context, db *sql.DB, eventsData []models.RawEventData, obsBefore time.Time, cfg models.Config) ([]models.RawEventsInsertDate, error) {
-	const table = "CustomerEvent"
-	const chunkSize = 1000
+	table := ResolveSchema(cfg.Schema).EventTable
+	size := chunkSize(cfg)
+	d := dialectOf(db)
 
 	const layout = "2006-01-02 15:04:05"
 	pObs := obsBefore.Format(layout)
@@ -132,8 +270,8 @@ func LoadOrdersInsertDate(ctx context.Context, db *sql.DB, eventsData []models.R
 
 	out := make([]models.RawEventsInsertDate, 0, len(ids)) // capacité approximative
 	// 2) Parcours par lots
-	for start := 0; start < len(ids); start += chunkSize {
-		end := start + chunkSize
+	for start := 0; start < len(ids); start += size {
+		end := start + size
 		if end > len(ids) {
 			end = len(ids)
 		}
@@ -156,21 +294,21 @@ func LoadOrdersInsertDate(ctx context.Context, db *sql.DB, eventsData []models.R
 		}
 		args = append(args, pObs)
 
-		rows, err := db.QueryContext(ctx, q, args...)
+		rows, err := db.QueryContext(ctx, d.rebind(q), args...)
 		if err != nil {
 			return nil, err
 		}
-		func() {
-			defer rows.Close()
-			for rows.Next() {
-				var ev models.RawEventsInsertDate
-				if err := rows.Scan(&ev.EventID, &ev.InsertDate); err != nil {
-					out = nil
-				}
-				out = append(out, ev)
+		for rows.Next() {
+			var ev models.RawEventsInsertDate
+			if err := rows.Scan(&ev.EventID, dbTime{&ev.InsertDate}); err != nil {
+				rows.Close()
+				return nil, err
 			}
-		}()
-		if err := rows.Err(); err != nil {
+			out = append(out, ev)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
 			return nil, err
 		}
 		if cfg.Verbose {
@@ -190,11 +328,18 @@ func LoadOrdersInsertDate(ctx context.Context, db *sql.DB, eventsData []models.R
 
 // LoadCohortCustomers récupère les clients dont la première commande se situe dans l'intervalle de temps spécifié, les identifiant ainsi comme membres des cohortes de cette période.
 func LoadCohortCustomers(ctx context.Context, db *sql.DB, cohortStart, cohortEnd time.Time, cfg models.Config) ([]models.CohortCustomer, error) {
-	const table = "CustomerEventData"
+	sch := ResolveSchema(cfg.Schema)
+	table := sch.EventDataTable
+
+	// Les événements postérieurs à l'observation ne doivent pas faire entrer un client dans une cohorte.
+	bound := cohortEnd
+	if !cfg.Observation.IsZero() && cfg.Observation.Before(bound) {
+		bound = cfg.Observation
+	}
 
 	const layout = "2006-01-02 15:04:05"
 	cStart := cohortStart.Format(layout)
-	cEnd := cohortEnd.Format(layout)
+	cEnd := bound.Format(layout)
 
 	q := fmt.Sprintf(`
 		SELECT ced.CustomerID,
@@ -205,7 +350,7 @@ func LoadCohortCustomers(ctx context.Context, db *sql.DB, cohortStart, cohortEnd
 		HAVING MIN(ced.EventDate) >= ?
 	`, table)
 
-	rows, err := db.QueryContext(ctx, q, orderEventTypeID, cEnd, cStart)
+	rows, err := db.QueryContext(ctx, dialectOf(db).rebind(q), sch.PurchaseEventTypeID, cEnd, cStart)
 	if err != nil {
 		return nil, err
 	}
@@ -215,7 +360,7 @@ func LoadCohortCustomers(ctx context.Context, db *sql.DB, cohortStart, cohortEnd
 	count := 0
 	for rows.Next() {
 		var r models.CohortCustomer
-		if err := rows.Scan(&r.CustomerID, &r.FirstOrderDT); err != nil {
+		if err := rows.Scan(&r.CustomerID, dbTime{&r.FirstOrderDT}); err != nil {
 			return nil, err
 		}
 		out = append(out, r)
@@ -232,60 +377,264 @@ func LoadCohortCustomers(ctx context.Context, db *sql.DB, cohortStart, cohortEnd
 }
 
 // LoadOrderEventsWithCustomersID charge tous les événements de commande pour une liste spécifique de clients, avant la date d'observation.
+// Les CustomerID sont envoyés par lots de cfg.ChunkSize (limite de 65 535 placeholders et max_allowed_packet),
+// éventuellement en parallèle sur cfg.LoadWorkers connexions du pool.
 func LoadOrderEventsWithCustomersID(ctx context.Context, db *sql.DB, customersID []models.CohortCustomer, obsBefore time.Time, cfg models.Config) ([]models.RawEventData, error) {
-	const table = "CustomerEventData"
-
 	const layout = "2006-01-02 15:04:05"
 	pObs := obsBefore.Format(layout)
 
 	if len(customersID) == 0 {
 		return []models.RawEventData{}, nil
 	}
-	ids := make([]any, 0, len(customersID))
-	for _, c := range customersID {
+	batches := customerBatches(customersID, cfg)
+
+	// Chaque lot écrit dans son propre slot : l'ordre du résultat ne dépend pas de la concurrence.
+	parts := make([][]models.RawEventData, len(batches))
+	err := parallel.ForEach(ctx, len(batches), cfg.LoadWorkers, func(ctx context.Context, i int) error {
+		evs, err := loadOrderEventsBatch(ctx, db, batches[i], pObs, cfg)
+		if err != nil {
+			return err
+		}
+		parts[i] = evs
+		if cfg.Verbose {
+			log.Printf("[INFO] [LOAD] customers chunk %d/%d (batch=%d, events=%d)", i+1, len(batches), len(batches[i]), len(evs))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	n := 0
+	for _, p := range parts {
+		n += len(p)
+	}
+	out := make([]models.RawEventData, 0, n)
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	if cfg.Verbose {
+		log.Printf("[INFO] [LOAD] events by CustomerID: %d", n)
+	}
+	return out, nil
+}
+
+// StreamOrderEventsWithCustomersID transmet à fn, sans les matérialiser, les événements de commande des clients
+// fournis antérieurs à obsBefore, par lots comme LoadOrderEventsWithCustomersID. Les lots sont lus sur au plus
+// cfg.LoadWorkers connexions ; fn n'est appelée que par une goroutine à la fois.
+func StreamOrderEventsWithCustomersID(ctx context.Context, db *sql.DB, customersID []models.CohortCustomer, obsBefore time.Time, cfg models.Config, fn func(models.RawEventData) error) error {
+	const layout = "2006-01-02 15:04:05"
+	pObs := obsBefore.Format(layout)
+
+	batches := customerBatches(customersID, cfg)
+	var mu sync.Mutex
+	return parallel.ForEach(ctx, len(batches), cfg.LoadWorkers, func(ctx context.Context, i int) error {
+		n := 0
+		err := streamOrderEventsBatch(ctx, db, batches[i], pObs, cfg, func(ev models.RawEventData) error {
+			mu.Lock()
+			defer mu.Unlock()
+			n++
+			return fn(ev)
+		})
+		if err != nil {
+			return err
+		}
+		if cfg.Verbose {
+			log.Printf("[INFO] [LOAD] customers chunk %d/%d (batch=%d, events=%d)", i+1, len(batches), len(batches[i]), n)
+		}
+		return nil
+	})
+}
+
+// customerBatches découpe les CustomerID de customers en lots de chunkSize(cfg) arguments de requête.
+func customerBatches(customers []models.CohortCustomer, cfg models.Config) [][]any {
+	ids := make([]any, 0, len(customers))
+	for _, c := range customers {
 		ids = append(ids, c.CustomerID)
 	}
+	size := chunkSize(cfg)
+	var batches [][]any
+	for start := 0; start < len(ids); start += size {
+		batches = append(batches, ids[start:min(start+size, len(ids))])
+	}
+	return batches
+}
 
-	customersIDs := strings.Repeat("?,", len(ids))
-	customersIDs = customersIDs[:len(customersIDs)-1]
+// loadOrderEventsBatch exécute la requête IN (...) pour un lot de CustomerID.
+func loadOrderEventsBatch(ctx context.Context, db *sql.DB, ids []any, pObs string, cfg models.Config) ([]models.RawEventData, error) {
+	out := make([]models.RawEventData, 0, len(ids))
+	err := streamOrderEventsBatch(ctx, db, ids, pObs, cfg, func(ev models.RawEventData) error {
+		out = append(out, ev)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// streamOrderEventsBatch exécute la requête IN (...) pour un lot de CustomerID et transmet chaque événement à fn.
+func streamOrderEventsBatch(ctx context.Context, db *sql.DB, ids []any, pObs string, cfg models.Config, fn func(models.RawEventData) error) error {
+	table := ResolveSchema(cfg.Schema).EventDataTable
+
+	customersIDs := strings.TrimRight(strings.Repeat("?,", len(ids)), ",")
+	d := dialectOf(db)
 
+	cols, err := orderEventColumns(d, cfg)
+	if err != nil {
+		return err
+	}
+	types, typeArgs := eventTypesFilter(cfg)
 	q := fmt.Sprintf(`
-		SELECT
-			ced.CustomerID,
-			ced.EventDate,
-			COALESCE(ced.Quantity, 1) AS qty,
-			CAST(JSON_EXTRACT(ced.Digest, '$.price.originalUnitPrice') AS DECIMAL(18,6)) AS unit_price
+		SELECT %s
 		FROM %s ced
-		WHERE ced.EventTypeID = ?
+		WHERE ced.EventTypeID IN (%s)
 		  AND ced.CustomerID IN (%s)
 		  AND ced.EventDate < ?
-	`, table, customersIDs)
-	args := make([]any, 0, len(ids)+2)
-	args = append(args, orderEventTypeID)
+	`, cols, table, types, customersIDs)
+	args := make([]any, 0, len(typeArgs)+len(ids)+1)
+	args = append(args, typeArgs...)
 	args = append(args, ids...)
 	args = append(args, pObs)
 
-	rows, err := db.QueryContext(ctx, q, args...)
+	rows, err := db.QueryContext(ctx, d.rebind(q), args...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 
-	out := make([]models.RawEventData, 0, 1024)
-	var n int
 	for rows.Next() {
-		var ev models.RawEventData
-		if err := rows.Scan(&ev.CustomerID, &ev.EventDate, &ev.Quantity, &ev.UnitPrice); err != nil {
-			return nil, err
+		ev, err := scanOrderEvent(rows, cfg)
+		if err != nil {
+			return err
+		}
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// StreamOrderEventsWithInsertDate transmet à fn, sans les matérialiser, les événements de commande antérieurs
+// à obsBefore, dont EventDate est remplacée par leur plus ancienne InsertDate de CustomerEvent antérieure
+// à obsBefore si elle existe : une seule requête, jointe aux dates d'insertion agrégées par EventID.
+func StreamOrderEventsWithInsertDate(ctx context.Context, db *sql.DB, obsBefore time.Time, cfg models.Config, fn func(models.RawEventData) error) error {
+	sch := ResolveSchema(cfg.Schema)
+	d := dialectOf(db)
+
+	const layout = "2006-01-02 15:04:05"
+	pObs := obsBefore.Format(layout)
+	cols, err := orderEventColumns(d, cfg)
+	if err != nil {
+		return err
+	}
+	types, typeArgs := eventTypesFilter(cfg)
+	q := fmt.Sprintf(`
+		SELECT %s,
+			ins.InsertDate
+		FROM %s ced
+		LEFT JOIN (
+			SELECT EventID, MIN(InsertDate) AS InsertDate
+			FROM %s
+			WHERE InsertDate < ?
+			GROUP BY EventID
+		) ins ON ins.EventID = ced.EventID
+		WHERE ced.EventTypeID IN (%s)
+		  AND ced.EventDate < ?
+	`, cols, sch.EventDataTable, sch.EventTable, types)
+	args := make([]any, 0, len(typeArgs)+2)
+	args = append(args, pObs)
+	args = append(args, typeArgs...)
+	args = append(args, pObs)
+
+	rows, err := db.QueryContext(ctx, d.rebind(q), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var n, redated int
+	for rows.Next() {
+		var inserted time.Time
+		ev, err := scanOrderEvent(rows, cfg, dbTime{&inserted})
+		if err != nil {
+			return err
+		}
+		if !inserted.IsZero() {
+			ev.EventDate = inserted
+			redated++
+		}
+		if err := fn(ev); err != nil {
+			return err
 		}
-		out = append(out, ev)
 		n++
 	}
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return err
 	}
 	if cfg.Verbose {
-		log.Printf("[INFO] [LOAD] events by CustomerID: %d", n)
+		log.Printf("[INFO] [LOAD] events: %d (%d dated by InsertDate)", n, redated)
 	}
-	return out, nil
+	return nil
+}
+
+// orderEventColumns renvoie la liste SELECT commune aux loaders d'événements d'achat, dans le dialecte d :
+// colonnes fixes, prix extrait du Digest, puis une colonne par chemin de cfg.SegmentBy.
+func orderEventColumns(d dialect, cfg models.Config) (string, error) {
+	if err := CheckSegmentPaths(cfg.SegmentBy); err != nil {
+		return "", err
+	}
+	sch := ResolveSchema(cfg.Schema)
+	cols := fmt.Sprintf(`
+			ced.EventID,
+			ced.CustomerID,
+			ced.EventTypeID,
+			ced.EventDate,
+			COALESCE(ced.Quantity, 1) AS qty,
+			%s AS unit_price`, d.jsonDecimal("ced.Digest", sch.PricePath))
+	if cfg.Currency != nil {
+		cols += fmt.Sprintf(`,
+			%s AS currency`, d.jsonText("ced.Digest", sch.CurrencyPath))
+	}
+	for i, path := range cfg.SegmentBy {
+		cols += fmt.Sprintf(`,
+			%s AS seg_%d`, d.jsonText("ced.Digest", path), i)
+	}
+	return cols, nil
+}
+
+// scanOrderEvent lit une ligne produite par orderEventColumns, suivie des colonnes lues dans extra ;
+// une devise ou un segment absent (NULL) vaut "".
+func scanOrderEvent(rows *sql.Rows, cfg models.Config, extra ...any) (models.RawEventData, error) {
+	var ev models.RawEventData
+	dest := []any{&ev.EventID, &ev.CustomerID, &ev.EventTypeID, dbTime{&ev.EventDate}, &ev.Quantity, &ev.UnitPrice}
+	var currency sql.NullString
+	if cfg.Currency != nil {
+		dest = append(dest, &currency)
+	}
+	segments := len(cfg.SegmentBy)
+	segs := make([]sql.NullString, segments)
+	for i := range segs {
+		dest = append(dest, &segs[i])
+	}
+	dest = append(dest, extra...)
+	if err := rows.Scan(dest...); err != nil {
+		return ev, err
+	}
+	ev.Currency = currency.String
+	if segments > 0 {
+		ev.Segments = make([]string, segments)
+		for i, v := range segs {
+			ev.Segments[i] = v.String
+		}
+	}
+	return ev, nil
+}
+
+// chunkSize renvoie la taille des lots IN (...) configurée, ou defaultChunkSize.
+func chunkSize(cfg models.Config) int {
+	if cfg.ChunkSize > 0 {
+		return cfg.ChunkSize
+	}
+	return defaultChunkSize
 }
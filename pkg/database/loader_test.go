@@ -1,8 +1,15 @@
 package database
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
 	"strings"
 	"testing"
+	"time"
+
+	"ltv-monthly/pkg/models"
 )
 
 func TestToMySQLDSN_MariaDBURL(t *testing.T) {
@@ -53,3 +60,86 @@ func TestToMySQLDSN_Incomplete(t *testing.T) {
 		t.Fatal("expected error for incomplete DSN, got nil")
 	}
 }
+
+func TestChunkSize_Default(t *testing.T) {
+	if got := chunkSize(models.Config{}); got != defaultChunkSize {
+		t.Fatalf("got %d, want %d", got, defaultChunkSize)
+	}
+	if got := chunkSize(models.Config{ChunkSize: 250}); got != 250 {
+		t.Fatalf("got %d, want 250", got)
+	}
+}
+
+func TestLoadOrderEventsWithCustomersID_CanceledContext(t *testing.T) {
+	// Aucune connexion n'est ouverte : le contexte annulé doit être respecté avant tout lot.
+	db, err := sql.Open("mysql", "u:p@tcp(127.0.0.1:1)/none")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	customers := make([]models.CohortCustomer, 2500)
+	for i := range customers {
+		customers[i].CustomerID = uint64(i + 1)
+	}
+	_, err = LoadOrderEventsWithCustomersID(ctx, db, customers, time.Now(), models.Config{ChunkSize: 1000, LoadWorkers: 3})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+}
+
+func TestCohortStartDate(t *testing.T) {
+	got, err := cohortStartDate(models.CohortResult{MonthYear: "03/2025"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "2025-03-01" {
+		t.Fatalf("got %q, want %q", got, "2025-03-01")
+	}
+	week := models.CohortResult{MonthYear: "2025-W03", PeriodStart: time.Date(2025, 1, 13, 0, 0, 0, 0, time.UTC)}
+	if got, _ := cohortStartDate(week); got != "2025-01-13" {
+		t.Fatalf("got %q, want %q", got, "2025-01-13")
+	}
+	if _, err := cohortStartDate(models.CohortResult{MonthYear: "2025-W03"}); err == nil {
+		t.Fatal("expected error for label without period start, got nil")
+	}
+}
+
+func TestEnsureResultsTable_InvalidName(t *testing.T) {
+	err := EnsureResultsTable(context.Background(), nil, "Results; DROP TABLE x")
+	if err == nil {
+		t.Fatal("expected error for invalid table name, got nil")
+	}
+}
+
+func TestSegmentKey(t *testing.T) {
+	if got := segmentKey(nil); got != "" {
+		t.Fatalf("got %q, want empty", got)
+	}
+	got := segmentKey(map[string]string{"$.country": "FR", "$.channel": "web"})
+	if want := "$.channel=web|$.country=FR"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestSplitCustomerRange(t *testing.T) {
+	got := splitCustomerRange(1, 10, 3)
+	want := []models.CustomerRange{{From: 1, To: 4}, {From: 5, To: 7}, {From: 8, To: 10}}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %+v, want %+v", got, want)
+		}
+	}
+	// moins d'IDs que de plages demandées : une plage par ID
+	if got := splitCustomerRange(7, 8, 5); len(got) != 2 || got[0].To != 7 || got[1].From != 8 {
+		t.Fatalf("unexpected ranges: %+v", got)
+	}
+	if got := splitCustomerRange(0, math.MaxUint64, 4); got[0].From != 0 || got[3].To != math.MaxUint64 || got[1].From != got[0].To+1 {
+		t.Fatalf("unexpected ranges over the full space: %+v", got)
+	}
+}
@@ -0,0 +1,109 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"ltv-monthly/pkg/models"
+	"ltv-monthly/pkg/parallel"
+)
+
+// CustomerRanges découpe l'espace des CustomerID de la table des événements en au plus n plages contiguës
+// de même largeur, bornées par MIN/MAX(CustomerID) (lus sur l'index, sans filtre) ; nil si la table est vide.
+func CustomerRanges(ctx context.Context, db *sql.DB, n int, cfg models.Config) ([]models.CustomerRange, error) {
+	table := ResolveSchema(cfg.Schema).EventDataTable
+	var lo, hi sql.Null[uint64]
+	q := fmt.Sprintf("SELECT MIN(CustomerID), MAX(CustomerID) FROM %s", dialectOf(db).table(table))
+	if err := db.QueryRowContext(ctx, q).Scan(&lo, &hi); err != nil {
+		return nil, err
+	}
+	if !lo.Valid || !hi.Valid {
+		return nil, nil
+	}
+	return splitCustomerRange(lo.V, hi.V, n), nil
+}
+
+// splitCustomerRange découpe [lo, hi] en au plus n plages contiguës dont les tailles diffèrent d'au plus 1.
+func splitCustomerRange(lo, hi uint64, n int) []models.CustomerRange {
+	if n < 1 {
+		n = 1
+	}
+	span := hi - lo // nombre d'IDs - 1
+	if span < uint64(n) {
+		n = int(span) + 1
+	}
+	count := span + 1
+	if span == math.MaxUint64 {
+		count = span
+	}
+	step, rem := count/uint64(n), count%uint64(n)
+
+	out := make([]models.CustomerRange, n)
+	from := lo
+	for i := range out {
+		size := step
+		if uint64(i) < rem {
+			size++
+		}
+		to := from + size - 1
+		if i == n-1 {
+			to = hi
+		}
+		out[i] = models.CustomerRange{From: from, To: to}
+		from = to + 1
+	}
+	return out
+}
+
+// StreamOrderEventsInRange parcourt comme StreamOrderEvents les événements de commande des clients de la plage r.
+func StreamOrderEventsInRange(ctx context.Context, db *sql.DB, r models.CustomerRange, obsBefore time.Time, cfg models.Config, fn func(models.RawEventData) error) error {
+	_, err := streamOrderEvents(ctx, db, time.Time{}, obsBefore, &r, cfg, fn)
+	return err
+}
+
+// loadOrderEventsPartitioned charge les événements avant obsBefore par plages de CustomerID (cfg.Partitions),
+// lues en parallèle sur cfg.LoadWorkers connexions ; le résultat suit l'ordre des plages.
+func loadOrderEventsPartitioned(ctx context.Context, db *sql.DB, obsBefore time.Time, cfg models.Config) ([]models.RawEventData, error) {
+	ranges, err := CustomerRanges(ctx, db, cfg.Partitions, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("customer ranges: %w", err)
+	}
+	parts := make([][]models.RawEventData, len(ranges))
+	err = parallel.ForEach(ctx, len(ranges), cfg.LoadWorkers, func(ctx context.Context, i int) error {
+		start := time.Now()
+		var evs []models.RawEventData
+		err := StreamOrderEventsInRange(ctx, db, ranges[i], obsBefore, cfg, func(ev models.RawEventData) error {
+			evs = append(evs, ev)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		parts[i] = evs
+		if cfg.Verbose {
+			log.Printf("[INFO] [LOAD] partition %d/%d CustomerID [%d, %d]: events=%d in %s",
+				i+1, len(ranges), ranges[i].From, ranges[i].To, len(evs), time.Since(start))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	n := 0
+	for _, p := range parts {
+		n += len(p)
+	}
+	out := make([]models.RawEventData, 0, n)
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	if cfg.Verbose {
+		log.Printf("[INFO] [LOAD] events: %d (%d partitions)", n, len(ranges))
+	}
+	return out, nil
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"ltv-monthly/pkg/models"
+)
+
+// pushdownQuery construit la requête du mode pushdown : la première commande de chaque client (CTE firsts)
+// est jointe à ses sommes de revenu, d'événements valorisés et de remboursements (CTE sums), puis
+// regroupée par période de cohorte, dans le dialecte d. Les règles sont celles de l'agrégation en Go (calculator) :
+// revenu = prix > 0 et quantité > 0 ; remboursement = |prix × quantité| des types de RefundEventTypeIDs.
+func pushdownQuery(d dialect, cfg models.Config) (string, []any, error) {
+	sch := ResolveSchema(cfg.Schema)
+	if err := CheckSchema(sch); err != nil {
+		return "", nil, err
+	}
+	startExpr, err := d.cohortStart(cfg.Granularity, "f.first_dt")
+	if err != nil {
+		return "", nil, err
+	}
+	types, typeArgs := eventTypesFilter(cfg)
+	refundArgs := typeArgs[1:]
+
+	refundSum := "0"
+	if len(refundArgs) > 0 {
+		refundSum = fmt.Sprintf(`SUM(CASE WHEN EventTypeID IN (%s) AND unit_price <> 0 AND qty > 0
+					THEN ABS(unit_price * qty) ELSE 0 END)`, strings.TrimRight(strings.Repeat("?,", len(refundArgs)), ","))
+	}
+
+	q := fmt.Sprintf(`
+		WITH ev AS (
+			SELECT ced.CustomerID, ced.EventTypeID, ced.EventDate,
+				COALESCE(ced.Quantity, 1) AS qty,
+				%[1]s AS unit_price
+			FROM %[2]s ced
+			WHERE ced.EventTypeID IN (%[3]s) AND ced.EventDate < ?
+		),
+		firsts AS (
+			SELECT CustomerID, MIN(EventDate) AS first_dt
+			FROM ev
+			WHERE EventTypeID = ?
+			GROUP BY CustomerID
+		),
+		sums AS (
+			SELECT CustomerID,
+				SUM(CASE WHEN EventTypeID = ? AND unit_price > 0 AND qty > 0 THEN unit_price * qty ELSE 0 END) AS revenue,
+				SUM(CASE WHEN EventTypeID = ? AND unit_price > 0 AND qty > 0 THEN 1 ELSE 0 END) AS events,
+				%[4]s AS refunds
+			FROM ev
+			GROUP BY CustomerID
+		)
+		SELECT %[5]s AS cohort_start,
+			COUNT(*) AS clients,
+			CAST(COALESCE(SUM(s.revenue), 0) AS DECIMAL(30,6)) AS revenue,
+			COALESCE(SUM(s.events), 0) AS events,
+			CAST(COALESCE(SUM(s.refunds), 0) AS DECIMAL(30,6)) AS refunds
+		FROM firsts f
+		JOIN sums s ON s.CustomerID = f.CustomerID
+		WHERE f.first_dt >= ? AND f.first_dt < ?
+		GROUP BY cohort_start
+		ORDER BY cohort_start
+	`, d.jsonDecimal("ced.Digest", sch.PricePath), sch.EventDataTable, types, refundSum, startExpr)
+
+	const layout = "2006-01-02 15:04:05"
+	args := append([]any{}, typeArgs...)
+	args = append(args, cfg.Observation.UTC().Format(layout))
+	args = append(args, sch.PurchaseEventTypeID, sch.PurchaseEventTypeID, sch.PurchaseEventTypeID)
+	args = append(args, refundArgs...)
+	return q, args, nil
+}
+
+// AggregateCohorts calcule en une seule requête groupée les agrégats des cohortes dont la première
+// commande est dans [cohortStart, cohortEnd) : une ligne par période, aucun événement transféré.
+func AggregateCohorts(ctx context.Context, db *sql.DB, cohortStart, cohortEnd time.Time, cfg models.Config) ([]models.CohortAggregate, error) {
+	d := dialectOf(db)
+	q, args, err := pushdownQuery(d, cfg)
+	if err != nil {
+		return nil, err
+	}
+	const layout = "2006-01-02 15:04:05"
+	args = append(args, cohortStart.UTC().Format(layout), cohortEnd.UTC().Format(layout))
+
+	start := time.Now()
+	rows, err := db.QueryContext(ctx, d.rebind(q), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []models.CohortAggregate
+	for rows.Next() {
+		var a models.CohortAggregate
+		if err := rows.Scan(dbTime{&a.PeriodStart}, &a.Clients, &a.Revenue, &a.Events, &a.Refunds); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if cfg.Verbose {
+		log.Printf("[INFO] [LOAD] pushdown: %d cohort rows in %s", len(out), time.Since(start))
+	}
+	return out, nil
+}
@@ -0,0 +1,176 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"ltv-monthly/pkg/models"
+)
+
+// DefaultResultsTable : table de résultats utilisée par -sink=db si aucune n'est précisée.
+const DefaultResultsTable = "LtvCohortResult"
+
+// ResultsRun décrit une exécution dont on persiste les résultats.
+type ResultsRun struct {
+	RunID       string    // identifiant de l'exécution (voir NewRunID)
+	Mode        string    // mode de calcul (normal, ramOptimized, withInsertDate, ...)
+	Granularity string    // taille des cohortes (day, week, month, quarter, year) ; "" = month
+	Observation time.Time // borne d'observation utilisée pour le calcul
+}
+
+// NewRunID génère un identifiant d'exécution aléatoire (32 caractères hexadécimaux).
+func NewRunID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// resultsKey : clé primaire de la table de résultats ; une table créée avant l'une de ses colonnes
+// (CohortMonth, sans granularité ni segments) ne peut pas être migrée sans recréer la clé.
+var resultsKey = []string{"CohortStart", "Granularity", "SegmentKey", "ObservationDate", "Mode"}
+
+// resultsAddedColumns : colonnes ajoutées après la création initiale de la table, hors clé,
+// ajoutées par ALTER TABLE aux tables existantes.
+var resultsAddedColumns = []struct{ name, ddl string }{
+	{"RefundsAvg", "DECIMAL(18,6) NOT NULL DEFAULT 0"},
+	{"NetLtvAvg", "DECIMAL(18,6) NOT NULL DEFAULT 0"},
+}
+
+// EnsureResultsTable crée la table de résultats si elle n'existe pas, ou met à niveau une table existante :
+// les colonnes de montants manquantes sont ajoutées ; une clé d'une version antérieure est une erreur.
+// La clé (CohortStart, Granularity, SegmentKey, ObservationDate, Mode) permet d'accumuler l'historique par date d'observation.
+func EnsureResultsTable(ctx context.Context, db *sql.DB, table string) error {
+	if !identRe.MatchString(table) {
+		return fmt.Errorf("nom de table invalide %q", table)
+	}
+	d := dialectOf(db)
+	q := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s ("+`
+			CohortStart     DATE          NOT NULL,
+			Granularity     VARCHAR(8)    NOT NULL,
+			SegmentKey      VARCHAR(255)  NOT NULL DEFAULT '',
+			ObservationDate %[2]s      NOT NULL,
+			Mode            VARCHAR(32)   NOT NULL,
+			LtvAvg          DECIMAL(18,6) NOT NULL,
+			CohortClients   INT           NOT NULL,
+			EventsRead      INT           NOT NULL,
+			RefundsAvg      DECIMAL(18,6) NOT NULL DEFAULT 0,
+			NetLtvAvg       DECIMAL(18,6) NOT NULL DEFAULT 0,
+			RunID           CHAR(32)      NOT NULL,
+			ComputedAt      %[2]s      NOT NULL,
+			PRIMARY KEY (CohortStart, Granularity, SegmentKey, ObservationDate, Mode)
+		)`, d.table(table), d.datetimeType())
+	if _, err := db.ExecContext(ctx, q); err != nil {
+		return err
+	}
+
+	present, err := tableColumns(ctx, db, table)
+	if err != nil {
+		return err
+	}
+	if missing := missingColumns(table, resultsKey, present); len(missing) > 0 {
+		return fmt.Errorf("table %s créée par une version antérieure (%s) : renommez-la ou choisissez une autre -sink_table",
+			table, strings.Join(missing, "; "))
+	}
+	for _, c := range resultsAddedColumns {
+		if _, ok := present[strings.ToLower(c.name)]; ok {
+			continue
+		}
+		if _, err := db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", d.table(table), c.name, c.ddl)); err != nil {
+			return fmt.Errorf("add column %s.%s: %w", table, c.name, err)
+		}
+	}
+	return nil
+}
+
+// SaveResults upsert les résultats de cohortes dans table, dans une seule transaction.
+// Une nouvelle exécution pour la même clé (CohortStart, Granularity, SegmentKey, ObservationDate, Mode)
+// remplace la précédente.
+func SaveResults(ctx context.Context, db *sql.DB, table string, run ResultsRun, results []models.CohortResult, cfg models.Config) error {
+	if !identRe.MatchString(table) {
+		return fmt.Errorf("nom de table invalide %q", table)
+	}
+	if err := EnsureResultsTable(ctx, db, table); err != nil {
+		return fmt.Errorf("create results table: %w", err)
+	}
+
+	const layout = "2006-01-02 15:04:05"
+	pObs := run.Observation.UTC().Format(layout)
+	now := time.Now().UTC().Format(layout)
+
+	d := dialectOf(db)
+	q := d.rebind(fmt.Sprintf("INSERT INTO %s "+`
+			(CohortStart, Granularity, SegmentKey, ObservationDate, Mode, LtvAvg, CohortClients, EventsRead, RefundsAvg, NetLtvAvg, RunID, ComputedAt)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		%s`, d.table(table), d.upsert(
+		resultsKey,
+		[]string{"LtvAvg", "CohortClients", "EventsRead", "RefundsAvg", "NetLtvAvg", "RunID", "ComputedAt"})))
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, q)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	granularity := run.Granularity
+	if granularity == "" {
+		granularity = "month"
+	}
+	for _, r := range results {
+		cohortStart, err := cohortStartDate(r)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.ExecContext(ctx, cohortStart, granularity, segmentKey(r.Segments), pObs, run.Mode, r.LTVAvg, r.CohortClients, r.EventsRead, r.RefundsAvg, r.NetLTVAvg, run.RunID, now); err != nil {
+			return fmt.Errorf("upsert %s: %w", r.MonthYear, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if cfg.Verbose {
+		log.Printf("[INFO] [SINK] %d results saved to %s (run=%s)", len(results), table, run.RunID)
+	}
+	return nil
+}
+
+// segmentKey sérialise les segments d'une ligne en "chemin=valeur" triés, séparés par "|" ("" sans segmentation).
+func segmentKey(segments map[string]string) string {
+	if len(segments) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(segments))
+	for k, v := range segments {
+		parts = append(parts, k+"="+v)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "|")
+}
+
+// cohortStartDate renvoie le début de période de la cohorte au format "YYYY-MM-DD" ;
+// à défaut de PeriodStart, le libellé mensuel "MM/YYYY" est converti.
+func cohortStartDate(r models.CohortResult) (string, error) {
+	if !r.PeriodStart.IsZero() {
+		return r.PeriodStart.UTC().Format("2006-01-02"), nil
+	}
+	t, err := time.Parse("01/2006", r.MonthYear)
+	if err != nil {
+		return "", fmt.Errorf("période de cohorte invalide %q", r.MonthYear)
+	}
+	return t.Format("2006-01-02"), nil
+}
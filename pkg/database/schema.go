@@ -0,0 +1,185 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"ltv-monthly/pkg/models"
+)
+
+// Valeurs par défaut du schéma (tenant historique "datafy").
+const (
+	defaultEventDataTable = "CustomerEventData"
+	defaultEventTable     = "CustomerEvent"
+	defaultPurchaseTypeID = 6 // "Purchase"
+	defaultPricePath      = "$.price.originalUnitPrice"
+	defaultCurrencyPath   = "$.price.currency"
+)
+
+// identRe restreint les noms de tables configurables aux identifiants simples (pas d'injection via les flags).
+var identRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+
+// jsonPathRe accepte les chemins JSON simples ($.a.b[0].c), insérés tels quels dans les requêtes.
+var jsonPathRe = regexp.MustCompile(`^\$(\.[A-Za-z_][A-Za-z0-9_]*|\[[0-9]+\])+$`)
+
+// ResolveSchema complète s avec les valeurs par défaut pour les champs non renseignés.
+func ResolveSchema(s models.Schema) models.Schema {
+	if s.EventDataTable == "" {
+		s.EventDataTable = defaultEventDataTable
+	}
+	if s.EventTable == "" {
+		s.EventTable = defaultEventTable
+	}
+	if s.PurchaseEventTypeID == 0 {
+		s.PurchaseEventTypeID = defaultPurchaseTypeID
+	}
+	if s.PricePath == "" {
+		s.PricePath = defaultPricePath
+	}
+	if s.CurrencyPath == "" {
+		s.CurrencyPath = defaultCurrencyPath
+	}
+	return s
+}
+
+// CheckSchema vérifie la syntaxe du mapping (identifiants et chemin JSON), sans accès à la base.
+func CheckSchema(s models.Schema) error {
+	s = ResolveSchema(s)
+	for _, t := range []string{s.EventDataTable, s.EventTable} {
+		if !identRe.MatchString(t) {
+			return fmt.Errorf("schema: nom de table invalide %q", t)
+		}
+	}
+	if !jsonPathRe.MatchString(s.PricePath) {
+		return fmt.Errorf("schema: chemin JSON invalide %q (ex: $.price.originalUnitPrice)", s.PricePath)
+	}
+	if !jsonPathRe.MatchString(s.CurrencyPath) {
+		return fmt.Errorf("schema: chemin JSON invalide %q (ex: $.price.currency)", s.CurrencyPath)
+	}
+	if s.PurchaseEventTypeID < 0 {
+		return fmt.Errorf("schema: EventTypeID d'achat invalide %d", s.PurchaseEventTypeID)
+	}
+	return nil
+}
+
+// CheckSegmentPaths vérifie la syntaxe des chemins JSON de segmentation (-segment_by).
+func CheckSegmentPaths(paths []string) error {
+	for _, p := range paths {
+		if !jsonPathRe.MatchString(p) {
+			return fmt.Errorf("segment_by: chemin JSON invalide %q (ex: $.channel)", p)
+		}
+	}
+	return nil
+}
+
+// requiredColumns liste les colonnes lues par les loaders dans chaque table du mapping.
+func requiredColumns(s models.Schema) map[string][]string {
+	return map[string][]string{
+		s.EventDataTable: {"EventID", "CustomerID", "EventTypeID", "EventDate", "Quantity", "Digest"},
+		s.EventTable:     {"EventID", "InsertDate"},
+	}
+}
+
+// EnsureEventTables crée, si elles n'existent pas, les tables d'événements du mapping s dans le dialecte
+// de db (bases de test, données synthétiques) : colonnes de requiredColumns, indexées comme les loaders les lisent.
+func EnsureEventTables(ctx context.Context, db *sql.DB, s models.Schema) error {
+	if err := CheckSchema(s); err != nil {
+		return err
+	}
+	s = ResolveSchema(s)
+	d := dialectOf(db)
+
+	// MySQL n'a pas de CREATE INDEX IF NOT EXISTS : ses index sont déclarés dans la table
+	inline := ""
+	if d == dialectMySQL {
+		inline = `,
+			KEY idx_customer (CustomerID),
+			KEY idx_type_date (EventTypeID, EventDate)`
+	}
+	stmts := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			EventID     %s NOT NULL PRIMARY KEY,
+			CustomerID  %[2]s NOT NULL,
+			EventTypeID INT    NOT NULL,
+			EventDate   %s NOT NULL,
+			Quantity    INT    NULL,
+			Digest      %s   NULL%s
+		)`, d.table(s.EventDataTable), d.uint64Type(), d.datetimeType(), d.jsonType(), inline),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			EventID    %s NOT NULL PRIMARY KEY,
+			InsertDate %s NOT NULL
+		)`, d.table(s.EventTable), d.uint64Type(), d.datetimeType()),
+	}
+	if d != dialectMySQL {
+		stmts = append(stmts,
+			fmt.Sprintf("CREATE INDEX IF NOT EXISTS %[1]s_customer ON %[1]s (CustomerID)", s.EventDataTable),
+			fmt.Sprintf("CREATE INDEX IF NOT EXISTS %[1]s_type_date ON %[1]s (EventTypeID, EventDate)", s.EventDataTable))
+	}
+	for _, q := range stmts {
+		if _, err := db.ExecContext(ctx, q); err != nil {
+			return fmt.Errorf("create event tables: %w", err)
+		}
+	}
+	return nil
+}
+
+// ValidateSchema vérifie le mapping contre le catalogue de la base courante (INFORMATION_SCHEMA,
+// ou pragma_table_info pour SQLite), afin d'échouer dès le démarrage avec un message clair
+// si une table ou une colonne manque.
+func ValidateSchema(ctx context.Context, db *sql.DB, s models.Schema) error {
+	if err := CheckSchema(s); err != nil {
+		return err
+	}
+	s = ResolveSchema(s)
+
+	var problems []string
+	for table, cols := range requiredColumns(s) {
+		present, err := tableColumns(ctx, db, table)
+		if err != nil {
+			return err
+		}
+		problems = append(problems, missingColumns(table, cols, present)...)
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("schema invalide: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// tableColumns renvoie les colonnes (en minuscules) de table lues dans le catalogue ; vide si la table n'existe pas.
+func tableColumns(ctx context.Context, db *sql.DB, table string) (map[string]struct{}, error) {
+	d := dialectOf(db)
+	rows, err := db.QueryContext(ctx, d.rebind(d.columnsQuery()), table)
+	if err != nil {
+		return nil, fmt.Errorf("schema: lecture INFORMATION_SCHEMA: %w", err)
+	}
+	defer rows.Close()
+	present := make(map[string]struct{}, 16)
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			return nil, err
+		}
+		present[strings.ToLower(c)] = struct{}{}
+	}
+	return present, rows.Err()
+}
+
+// missingColumns compare les colonnes attendues d'une table à celles présentes (noms en minuscules).
+func missingColumns(table string, want []string, present map[string]struct{}) []string {
+	if len(present) == 0 {
+		return []string{fmt.Sprintf("table %s introuvable", table)}
+	}
+	var out []string
+	for _, c := range want {
+		if _, ok := present[strings.ToLower(c)]; !ok {
+			out = append(out, fmt.Sprintf("colonne %s.%s introuvable", table, c))
+		}
+	}
+	return out
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"ltv-monthly/pkg/models"
+)
+
+func TestResolveSchema_Defaults(t *testing.T) {
+	got := ResolveSchema(models.Schema{EventDataTable: "ShopEventData"})
+	want := models.Schema{
+		EventDataTable:      "ShopEventData",
+		EventTable:          "CustomerEvent",
+		PurchaseEventTypeID: 6,
+		PricePath:           "$.price.originalUnitPrice",
+		CurrencyPath:        "$.price.currency",
+	}
+	if got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestCheckSchema(t *testing.T) {
+	if err := CheckSchema(models.Schema{PricePath: "$.lines[0].amount"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bad := []models.Schema{
+		{EventDataTable: "CustomerEventData; DROP TABLE x"},
+		{PricePath: "$.price') OR 1=1 --"},
+		{PricePath: "price.originalUnitPrice"},
+		{CurrencyPath: "$.price.currency'"},
+	}
+	for _, s := range bad {
+		if err := CheckSchema(s); err == nil {
+			t.Fatalf("expected error for %+v, got nil", s)
+		}
+	}
+}
+
+func TestMissingColumns(t *testing.T) {
+	present := map[string]struct{}{"eventid": {}, "customerid": {}}
+	got := missingColumns("T", []string{"EventID", "CustomerID", "Digest"}, present)
+	if len(got) != 1 || !strings.Contains(got[0], "T.Digest") {
+		t.Fatalf("unexpected problems: %v", got)
+	}
+	if got := missingColumns("T", []string{"EventID"}, nil); len(got) != 1 || !strings.Contains(got[0], "table T") {
+		t.Fatalf("unexpected problems for missing table: %v", got)
+	}
+}
+
+func TestPushdownQuery_Placeholders(t *testing.T) {
+	for _, d := range []dialect{dialectMySQL, dialectPostgres, dialectSQLite} {
+		for _, granularity := range []string{"day", "week", "month", "quarter", "year"} {
+			cfg := models.Config{Granularity: granularity, RefundEventTypeIDs: []int{7, 8}}
+			q, args, err := pushdownQuery(d, cfg)
+			if err != nil {
+				t.Fatalf("%s/%s: unexpected error: %v", d, granularity, err)
+			}
+			// AggregateCohorts ajoute les deux bornes de cohorte ; PostgreSQL numérote les placeholders
+			want := len(args) + 2
+			q = d.rebind(q)
+			if d == dialectPostgres {
+				if !strings.Contains(q, fmt.Sprintf("$%d", want)) || strings.Contains(q, fmt.Sprintf("$%d", want+1)) {
+					t.Fatalf("%s/%s: placeholders do not stop at $%d", d, granularity, want)
+				}
+			} else if n := strings.Count(q, "?"); n != want {
+				t.Fatalf("%s/%s: %d placeholders for %d args", d, granularity, n, want)
+			}
+		}
+	}
+	if _, _, err := pushdownQuery(dialectMySQL, models.Config{Granularity: "decade"}); err == nil {
+		t.Fatal("expected error for unknown granularity, got nil")
+	}
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"ltv-monthly/pkg/models"
+)
+
+// SQLSource expose les loaders SQL sous forme de source d'événements utilisable par le package
+// calculator ; le dialecte (MySQL/MariaDB, PostgreSQL, SQLite) suit le driver du pool (voir Open).
+type SQLSource struct {
+	DB *sql.DB
+}
+
+// NewSQLSource construit une source d'événements adossée au pool db.
+func NewSQLSource(db *sql.DB) *SQLSource {
+	return &SQLSource{DB: db}
+}
+
+func (s *SQLSource) LoadOrderEvents(ctx context.Context, obsBefore time.Time, cfg models.Config) ([]models.RawEventData, error) {
+	return LoadOrderEvents(ctx, s.DB, obsBefore, cfg)
+}
+
+func (s *SQLSource) StreamOrderEvents(ctx context.Context, obsBefore time.Time, cfg models.Config, fn func(models.RawEventData) error) error {
+	return StreamOrderEvents(ctx, s.DB, obsBefore, cfg, fn)
+}
+
+func (s *SQLSource) LoadOrdersInsertDate(ctx context.Context, events []models.RawEventData, obsBefore time.Time, cfg models.Config) ([]models.RawEventsInsertDate, error) {
+	return LoadOrdersInsertDate(ctx, s.DB, events, obsBefore, cfg)
+}
+
+func (s *SQLSource) LoadCohortCustomers(ctx context.Context, cohortStart, cohortEnd time.Time, cfg models.Config) ([]models.CohortCustomer, error) {
+	return LoadCohortCustomers(ctx, s.DB, cohortStart, cohortEnd, cfg)
+}
+
+func (s *SQLSource) LoadOrderEventsWithCustomersID(ctx context.Context, customers []models.CohortCustomer, obsBefore time.Time, cfg models.Config) ([]models.RawEventData, error) {
+	return LoadOrderEventsWithCustomersID(ctx, s.DB, customers, obsBefore, cfg)
+}
+
+// StreamOrderEventsWithCustomersID implémente calculator.CustomerEventStreamer.
+func (s *SQLSource) StreamOrderEventsWithCustomersID(ctx context.Context, customers []models.CohortCustomer, obsBefore time.Time, cfg models.Config, fn func(models.RawEventData) error) error {
+	return StreamOrderEventsWithCustomersID(ctx, s.DB, customers, obsBefore, cfg, fn)
+}
+
+// StreamOrderEventsWithInsertDate implémente calculator.InsertDateStreamer.
+func (s *SQLSource) StreamOrderEventsWithInsertDate(ctx context.Context, obsBefore time.Time, cfg models.Config, fn func(models.RawEventData) error) error {
+	return StreamOrderEventsWithInsertDate(ctx, s.DB, obsBefore, cfg, fn)
+}
+
+// AggregateCohorts implémente calculator.CohortAggregator (mode pushdown).
+func (s *SQLSource) AggregateCohorts(ctx context.Context, cohortStart, cohortEnd time.Time, cfg models.Config) ([]models.CohortAggregate, error) {
+	return AggregateCohorts(ctx, s.DB, cohortStart, cohortEnd, cfg)
+}
+
+// StreamOrderEventsBetween et CountOrderEvents implémentent calculator.IncrementalSource.
+func (s *SQLSource) StreamOrderEventsBetween(ctx context.Context, from, to time.Time, cfg models.Config, fn func(models.RawEventData) error) error {
+	return StreamOrderEventsBetween(ctx, s.DB, from, to, cfg, fn)
+}
+
+func (s *SQLSource) CountOrderEvents(ctx context.Context, before time.Time, cfg models.Config) (int, error) {
+	return CountOrderEvents(ctx, s.DB, before, cfg)
+}
+
+// CustomerRanges et StreamOrderEventsInRange implémentent calculator.PartitionedSource.
+func (s *SQLSource) CustomerRanges(ctx context.Context, n int, cfg models.Config) ([]models.CustomerRange, error) {
+	return CustomerRanges(ctx, s.DB, n, cfg)
+}
+
+func (s *SQLSource) StreamOrderEventsInRange(ctx context.Context, r models.CustomerRange, obsBefore time.Time, cfg models.Config, fn func(models.RawEventData) error) error {
+	return StreamOrderEventsInRange(ctx, s.DB, r, obsBefore, cfg, fn)
+}
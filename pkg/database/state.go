@@ -0,0 +1,152 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"ltv-monthly/pkg/models"
+)
+
+// DefaultStateTable : table d'état du calcul incrémental utilisée si aucune n'est précisée ;
+// l'en-tête (observation, empreinte, nombre d'événements) est dans la table suffixée "Meta".
+const DefaultStateTable = "LtvCustomerState"
+
+// stateInsertBatch : nombre de clients par INSERT multi-lignes lors de l'enregistrement de l'état.
+const stateInsertBatch = 500
+
+// StateStore persiste l'état du calcul incrémental dans deux tables de la base (MySQL/MariaDB,
+// PostgreSQL ou SQLite : une ligne par client, plus une ligne d'en-tête) ; implémente calculator.StateStore.
+type StateStore struct {
+	DB    *sql.DB
+	Table string
+}
+
+// NewStateStore construit un StateStore sur table (DefaultStateTable si vide).
+func NewStateStore(db *sql.DB, table string) (*StateStore, error) {
+	if table == "" {
+		table = DefaultStateTable
+	}
+	if !identRe.MatchString(table) {
+		return nil, fmt.Errorf("nom de table invalide %q", table)
+	}
+	return &StateStore{DB: db, Table: table}, nil
+}
+
+// ensureTables crée les tables d'état si elles n'existent pas.
+func (s *StateStore) ensureTables(ctx context.Context) error {
+	d := dialectOf(s.DB)
+	q := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s ("+`
+			CustomerID   %s NOT NULL PRIMARY KEY,
+			FirstOrderDT %s        NULL,
+			FirstEventID %[2]s NOT NULL DEFAULT 0,
+			Revenue      DECIMAL(30,6)   NOT NULL,
+			Events       INT             NOT NULL,
+			Refunds      DECIMAL(30,6)   NOT NULL,
+			Segments     TEXT            NULL
+		)`, d.table(s.Table), d.uint64Type(), d.datetimeType())
+	if _, err := s.DB.ExecContext(ctx, q); err != nil {
+		return err
+	}
+	q = fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s ("+`
+			ID              %s      NOT NULL PRIMARY KEY,
+			ObservationDate %s     NOT NULL,
+			Fingerprint     VARCHAR(64)  NOT NULL,
+			EventsRead      BIGINT       NOT NULL,
+			SavedAt         %[3]s     NOT NULL
+		)`, d.table(s.Table+"Meta"), d.smallintType(), d.datetimeType())
+	_, err := s.DB.ExecContext(ctx, q)
+	return err
+}
+
+// LoadState implémente calculator.StateStore : nil si aucun état n'a encore été enregistré.
+func (s *StateStore) LoadState(ctx context.Context) (*models.State, error) {
+	if err := s.ensureTables(ctx); err != nil {
+		return nil, fmt.Errorf("create state tables: %w", err)
+	}
+	d := dialectOf(s.DB)
+	var st models.State
+	err := s.DB.QueryRowContext(ctx, fmt.Sprintf("SELECT ObservationDate, Fingerprint, EventsRead FROM %s WHERE ID = 1", d.table(s.Table+"Meta"))).
+		Scan(dbTime{&st.Observation}, &st.Fingerprint, &st.EventsRead)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.DB.QueryContext(ctx, fmt.Sprintf(
+		"SELECT CustomerID, FirstOrderDT, FirstEventID, Revenue, Events, Refunds, Segments FROM %s ORDER BY CustomerID", d.table(s.Table)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c models.CustomerState
+		var segments sql.NullString
+		// FirstOrderDT NULL (client sans achat) : c.First reste à zéro
+		if err := rows.Scan(&c.CustomerID, dbTime{&c.First}, &c.FirstEventID, &c.Revenue, &c.Events, &c.Refunds, &segments); err != nil {
+			return nil, err
+		}
+		if segments.Valid {
+			if err := json.Unmarshal([]byte(segments.String), &c.Segments); err != nil {
+				return nil, fmt.Errorf("customer %d: segments: %w", c.CustomerID, err)
+			}
+		}
+		st.Customers = append(st.Customers, c)
+	}
+	return &st, rows.Err()
+}
+
+// SaveState implémente calculator.StateStore : remplace l'état dans une seule transaction.
+func (s *StateStore) SaveState(ctx context.Context, st *models.State) error {
+	if err := s.ensureTables(ctx); err != nil {
+		return fmt.Errorf("create state tables: %w", err)
+	}
+	d := dialectOf(s.DB)
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s", d.table(s.Table))); err != nil {
+		return err
+	}
+	const layout = "2006-01-02 15:04:05"
+	for start := 0; start < len(st.Customers); start += stateInsertBatch {
+		batch := st.Customers[start:min(start+stateInsertBatch, len(st.Customers))]
+		args := make([]any, 0, len(batch)*7)
+		for _, c := range batch {
+			var first, segments any
+			if !c.First.IsZero() {
+				first = c.First.UTC().Format(layout)
+			}
+			if c.Segments != nil {
+				b, err := json.Marshal(c.Segments)
+				if err != nil {
+					return err
+				}
+				segments = string(b)
+			}
+			args = append(args, c.CustomerID, first, c.FirstEventID, c.Revenue, c.Events, c.Refunds, segments)
+		}
+		q := fmt.Sprintf("INSERT INTO %s (CustomerID, FirstOrderDT, FirstEventID, Revenue, Events, Refunds, Segments) VALUES %s",
+			d.table(s.Table), strings.TrimRight(strings.Repeat("(?, ?, ?, ?, ?, ?, ?),", len(batch)), ","))
+		if _, err := tx.ExecContext(ctx, d.rebind(q), args...); err != nil {
+			return fmt.Errorf("insert state: %w", err)
+		}
+	}
+
+	q := fmt.Sprintf("INSERT INTO %s "+`(ID, ObservationDate, Fingerprint, EventsRead, SavedAt)
+		VALUES (1, ?, ?, ?, ?)
+		%s`, d.table(s.Table+"Meta"), d.upsert([]string{"ID"}, []string{"ObservationDate", "Fingerprint", "EventsRead", "SavedAt"}))
+	if _, err := tx.ExecContext(ctx, d.rebind(q), st.Observation.UTC().Format(layout), st.Fingerprint, st.EventsRead, time.Now().UTC().Format(layout)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
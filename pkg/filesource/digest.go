@@ -0,0 +1,125 @@
+package filesource
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"ltv-monthly/pkg/models"
+)
+
+// pathStep est une étape d'un chemin JSON : clé d'objet ou indice de tableau.
+type pathStep struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// parsePath découpe un chemin "$.a.b[0].c", dont la syntaxe a été validée par database.CheckSchema.
+func parsePath(path string) ([]pathStep, error) {
+	rest, ok := strings.CutPrefix(path, "$")
+	if !ok {
+		return nil, fmt.Errorf("chemin JSON invalide %q", path)
+	}
+	var steps []pathStep
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[") + 1
+			if end == 0 {
+				end = len(rest)
+			}
+			steps = append(steps, pathStep{key: rest[1:end]})
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("chemin JSON invalide %q", path)
+			}
+			i, err := strconv.Atoi(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("chemin JSON invalide %q", path)
+			}
+			steps = append(steps, pathStep{index: i, isIndex: true})
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("chemin JSON invalide %q", path)
+		}
+	}
+	return steps, nil
+}
+
+// parseDigest décode le Digest d'un événement ; les nombres sont conservés sous forme de json.Number.
+func parseDigest(digest []byte) (any, error) {
+	if len(bytes.TrimSpace(digest)) == 0 {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(digest))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// lookup suit steps dans doc, comme JSON_EXTRACT ; ok = false si le chemin n'existe pas.
+func lookup(doc any, steps []pathStep) (any, bool) {
+	for _, s := range steps {
+		if s.isIndex {
+			arr, ok := doc.([]any)
+			if !ok || s.index >= len(arr) {
+				return nil, false
+			}
+			doc = arr[s.index]
+			continue
+		}
+		obj, ok := doc.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if doc, ok = obj[s.key]; !ok {
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// moneyOf convertit un prix extrait du Digest, comme CAST(... AS DECIMAL(18,6)) : un nombre ou
+// une chaîne numérique ; toute autre valeur (absente, null, texte) vaut 0.
+func moneyOf(v any) models.Money {
+	var s string
+	switch x := v.(type) {
+	case json.Number:
+		s = x.String()
+	case string:
+		s = x
+	default:
+		return 0
+	}
+	if m, err := models.ParseMoney(s); err == nil {
+		return m
+	}
+	if f, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+		return models.MoneyFromFloat(f)
+	}
+	return 0
+}
+
+// textOf convertit une valeur extraite du Digest, comme JSON_UNQUOTE(JSON_EXTRACT(...)) :
+// chaîne telle quelle, autre valeur en JSON ; "" si le chemin n'existe pas.
+func textOf(v any, ok bool) string {
+	if !ok {
+		return ""
+	}
+	if s, isString := v.(string); isString {
+		return s
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
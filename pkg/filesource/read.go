@@ -0,0 +1,378 @@
+package filesource
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Colonnes reconnues (noms insensibles à la casse), calquées sur la table CustomerEventData ;
+// InsertDate (CustomerEvent) est facultative et ne sert qu'au mode withInsertDate.
+const (
+	colEventID = iota
+	colCustomerID
+	colEventTypeID
+	colEventDate
+	colQuantity
+	colDigest
+	colInsertDate
+	numColumns
+)
+
+var columnNames = [numColumns]string{"EventID", "CustomerID", "EventTypeID", "EventDate", "Quantity", "Digest", "InsertDate"}
+
+// requiredColumns : colonnes sans lesquelles un extrait est refusé.
+var requiredColumns = []int{colEventID, colCustomerID, colEventTypeID, colEventDate, colDigest}
+
+// record est une ligne d'extrait, avant extraction du Digest.
+type record struct {
+	EventID     uint64
+	CustomerID  uint64
+	EventTypeID int
+	EventDate   time.Time
+	Quantity    int // 1 si absente, comme COALESCE(Quantity, 1)
+	Digest      []byte
+	InsertDate  time.Time // zéro si absente
+}
+
+// columnIndex associe un nom de colonne (insensible à la casse) à son identifiant ; -1 si inconnu.
+func columnIndex(name string) int {
+	for i, c := range columnNames {
+		if strings.EqualFold(strings.TrimSpace(name), c) {
+			return i
+		}
+	}
+	return -1
+}
+
+// checkColumns vérifie que les colonnes obligatoires sont présentes.
+func checkColumns(present [numColumns]bool) error {
+	var missing []string
+	for _, c := range requiredColumns {
+		if !present[c] {
+			missing = append(missing, columnNames[c])
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("colonnes manquantes: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// set affecte à la colonne col la valeur v : string, json.Number, int64, time.Time, []byte ou nil (NULL).
+func (r *record) set(col int, v any) error {
+	if v == nil {
+		return nil
+	}
+	var err error
+	switch col {
+	case colEventID:
+		r.EventID, err = toUint(v)
+	case colCustomerID:
+		r.CustomerID, err = toUint(v)
+	case colEventTypeID:
+		r.EventTypeID, err = toInt(v)
+	case colQuantity:
+		r.Quantity, err = toInt(v)
+	case colEventDate:
+		r.EventDate, err = toTime(v)
+	case colInsertDate:
+		r.InsertDate, err = toTime(v)
+	case colDigest:
+		switch x := v.(type) {
+		case string:
+			r.Digest = []byte(x)
+		case []byte:
+			r.Digest = x
+		default:
+			err = fmt.Errorf("type %T inattendu", v)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", columnNames[col], err)
+	}
+	return nil
+}
+
+func toUint(v any) (uint64, error) {
+	switch x := v.(type) {
+	case int64:
+		if x < 0 {
+			return 0, fmt.Errorf("valeur négative %d", x)
+		}
+		return uint64(x), nil
+	case json.Number:
+		return strconv.ParseUint(x.String(), 10, 64)
+	case string:
+		return strconv.ParseUint(strings.TrimSpace(x), 10, 64)
+	}
+	return 0, fmt.Errorf("type %T inattendu", v)
+}
+
+func toInt(v any) (int, error) {
+	switch x := v.(type) {
+	case int64:
+		return int(x), nil
+	case json.Number:
+		return strconv.Atoi(x.String())
+	case string:
+		return strconv.Atoi(strings.TrimSpace(x))
+	}
+	return 0, fmt.Errorf("type %T inattendu", v)
+}
+
+// dateLayouts : formats de date acceptés dans les colonnes texte, interprétés en UTC.
+var dateLayouts = []string{"2006-01-02 15:04:05.999999999", time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02"}
+
+func toTime(v any) (time.Time, error) {
+	switch x := v.(type) {
+	case time.Time:
+		return x.UTC(), nil
+	case string:
+		s := strings.TrimSpace(x)
+		for _, layout := range dateLayouts {
+			if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+				return t.UTC(), nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("date invalide %q (attendu: YYYY-MM-DD HH:MM:SS, RFC3339 ou YYYY-MM-DD)", s)
+	}
+	return time.Time{}, fmt.Errorf("type %T inattendu", v)
+}
+
+// scanFile lit path au format f et transmet chaque ligne à fn ; hasInsertDate indique si la colonne existe.
+// La lecture s'arrête avec ctx.Err() dès que ctx est annulé.
+func scanFile(ctx context.Context, path string, f format, each func(record) error) (hasInsertDate bool, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	fn := func(r record) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return each(r)
+	}
+
+	switch f {
+	case formatCSV:
+		return scanCSV(file, fn)
+	case formatJSONL:
+		return scanJSONL(file, fn)
+	case formatParquet:
+		st, err := file.Stat()
+		if err != nil {
+			return false, err
+		}
+		return scanParquet(file, st.Size(), fn)
+	}
+	return false, fmt.Errorf("format inconnu %q", f)
+}
+
+// scanCSV lit un CSV avec en-tête ; une cellule vide vaut NULL.
+func scanCSV(r io.Reader, fn func(record) error) (bool, error) {
+	cr := csv.NewReader(bufio.NewReader(r))
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err != nil {
+		return false, fmt.Errorf("en-tête CSV: %w", err)
+	}
+	positions := make([]int, len(header)) // position → colonne
+	var present [numColumns]bool
+	for i, name := range header {
+		positions[i] = columnIndex(strings.TrimPrefix(name, "\ufeff"))
+		if positions[i] >= 0 {
+			present[positions[i]] = true
+		}
+	}
+	if err := checkColumns(present); err != nil {
+		return false, err
+	}
+
+	for line := 2; ; line++ {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return present[colInsertDate], nil
+		}
+		if err != nil {
+			return false, err
+		}
+		rec := record{Quantity: 1}
+		for i, v := range row {
+			if positions[i] < 0 || v == "" {
+				continue
+			}
+			if err := rec.set(positions[i], v); err != nil {
+				return false, fmt.Errorf("ligne %d: %w", line, err)
+			}
+		}
+		if err := fn(rec); err != nil {
+			return false, err
+		}
+	}
+}
+
+// scanJSONL lit un objet JSON par ligne ; Digest peut être un objet JSON ou une chaîne qui en contient un.
+func scanJSONL(r io.Reader, fn func(record) error) (bool, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	var present [numColumns]bool
+	for line := 1; sc.Scan(); line++ {
+		b := bytes.TrimSpace(sc.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(b, &obj); err != nil {
+			return false, fmt.Errorf("ligne %d: %w", line, err)
+		}
+		rec := record{Quantity: 1}
+		var seen [numColumns]bool
+		for name, raw := range obj {
+			col := columnIndex(name)
+			if col < 0 {
+				continue
+			}
+			seen[col] = true
+			v, err := jsonValue(raw, col == colDigest)
+			if err != nil {
+				return false, fmt.Errorf("ligne %d: %s: %w", line, columnNames[col], err)
+			}
+			if err := rec.set(col, v); err != nil {
+				return false, fmt.Errorf("ligne %d: %w", line, err)
+			}
+		}
+		if err := checkColumns(seen); err != nil {
+			return false, fmt.Errorf("ligne %d: %w", line, err)
+		}
+		present[colInsertDate] = present[colInsertDate] || seen[colInsertDate]
+		if err := fn(rec); err != nil {
+			return false, err
+		}
+	}
+	return present[colInsertDate], sc.Err()
+}
+
+// jsonValue convertit une valeur JSON brute pour record.set ; avec keepRaw, un objet ou un tableau est conservé tel quel (Digest).
+func jsonValue(raw json.RawMessage, keepRaw bool) (any, error) {
+	raw = bytes.TrimSpace(raw)
+	switch {
+	case len(raw) == 0 || bytes.Equal(raw, []byte("null")):
+		return nil, nil
+	case raw[0] == '"':
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, err
+		}
+		return s, nil
+	case keepRaw && (raw[0] == '{' || raw[0] == '['):
+		return []byte(raw), nil
+	}
+	return json.Number(raw), nil
+}
+
+// scanParquet lit un fichier Parquet à colonnes plates : entiers (INT32/INT64), dates TIMESTAMP ou texte, Digest texte.
+func scanParquet(r io.ReaderAt, size int64, fn func(record) error) (bool, error) {
+	pf, err := parquet.OpenFile(r, size)
+	if err != nil {
+		return false, err
+	}
+	cols := make(map[int]int) // indice de colonne Parquet → colonne
+	timeUnits := make(map[int]time.Duration)
+	var present [numColumns]bool
+	for _, path := range pf.Schema().Columns() {
+		if len(path) != 1 {
+			continue
+		}
+		col := columnIndex(path[0])
+		if col < 0 {
+			continue
+		}
+		leaf, _ := pf.Schema().Lookup(path...)
+		cols[leaf.ColumnIndex] = col
+		present[col] = true
+		if lt := leaf.Node.Type().LogicalType(); lt != nil && lt.Timestamp != nil {
+			switch {
+			case lt.Timestamp.Unit.Millis != nil:
+				timeUnits[leaf.ColumnIndex] = time.Millisecond
+			case lt.Timestamp.Unit.Micros != nil:
+				timeUnits[leaf.ColumnIndex] = time.Microsecond
+			default:
+				timeUnits[leaf.ColumnIndex] = time.Nanosecond
+			}
+		}
+	}
+	if err := checkColumns(present); err != nil {
+		return false, err
+	}
+
+	buf := make([]parquet.Row, 256)
+	line := 0
+	for _, rg := range pf.RowGroups() {
+		rows := rg.Rows()
+		for {
+			n, err := rows.ReadRows(buf)
+			for _, row := range buf[:n] {
+				line++
+				rec := record{Quantity: 1}
+				for _, v := range row {
+					col, ok := cols[v.Column()]
+					if !ok {
+						continue
+					}
+					if err := rec.set(col, parquetValue(v, timeUnits[v.Column()])); err != nil {
+						rows.Close()
+						return false, fmt.Errorf("ligne %d: %w", line, err)
+					}
+				}
+				if err := fn(rec); err != nil {
+					rows.Close()
+					return false, err
+				}
+			}
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				rows.Close()
+				return false, err
+			}
+		}
+		if err := rows.Close(); err != nil {
+			return false, err
+		}
+	}
+	return present[colInsertDate], nil
+}
+
+// parquetValue convertit une valeur Parquet pour record.set ; unit > 0 pour une colonne TIMESTAMP.
+func parquetValue(v parquet.Value, unit time.Duration) any {
+	if v.IsNull() {
+		return nil
+	}
+	switch v.Kind() {
+	case parquet.Int32:
+		return int64(v.Int32())
+	case parquet.Int64:
+		if unit > 0 {
+			return time.Unix(0, 0).Add(time.Duration(v.Int64()) * unit).UTC()
+		}
+		return v.Int64()
+	case parquet.ByteArray, parquet.FixedLenByteArray:
+		return string(v.ByteArray())
+	}
+	return v.String()
+}
@@ -0,0 +1,313 @@
+// Package filesource lit les événements depuis des extraits locaux (CSV, JSON Lines, Parquet) ayant
+// les colonnes de CustomerEventData, pour exécuter tous les modes de calcul sans base de données.
+package filesource
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"ltv-monthly/pkg/calculator"
+	"ltv-monthly/pkg/database"
+	"ltv-monthly/pkg/models"
+)
+
+// format identifie le format d'un extrait, déduit de son extension.
+type format string
+
+const (
+	formatCSV     format = "csv"
+	formatJSONL   format = "jsonl"
+	formatParquet format = "parquet"
+)
+
+// Source est une calculator.EventSource adossée à un fichier : chaque chargement relit l'extrait,
+// applique les filtres des requêtes SQL (types d'événements, bornes de dates) et extrait du Digest
+// le prix (Schema.PricePath), la devise et les segments.
+type Source struct {
+	Path   string
+	format format
+}
+
+// Open ouvre l'extrait désigné par uri ("file://events.parquet", "file:///data/events.csv" ou un chemin) ;
+// le format est déduit de l'extension : .csv, .jsonl (ou .ndjson), .parquet.
+func Open(uri string) (*Source, error) {
+	path := strings.TrimPrefix(uri, "file://")
+	var f format
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		f = formatCSV
+	case ".jsonl", ".ndjson":
+		f = formatJSONL
+	case ".parquet":
+		f = formatParquet
+	default:
+		return nil, fmt.Errorf("source %q: extension inconnue (attendu: .csv, .jsonl, .parquet)", uri)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("source %q: %w", uri, err)
+	}
+	return &Source{Path: path, format: f}, nil
+}
+
+// IsFileURI indique si uri désigne un extrait local plutôt qu'une base de données.
+func IsFileURI(uri string) bool {
+	return strings.HasPrefix(uri, "file://")
+}
+
+// extractor convertit les lignes de l'extrait en événements selon cfg.
+type extractor struct {
+	types    map[int]struct{} // achats et remboursements
+	purchase int
+	price    []pathStep
+	currency []pathStep // nil sans conversion de devises
+	segments [][]pathStep
+}
+
+func newExtractor(cfg models.Config) (*extractor, error) {
+	sch := database.ResolveSchema(cfg.Schema)
+	if err := database.CheckSchema(sch); err != nil {
+		return nil, err
+	}
+	if err := database.CheckSegmentPaths(cfg.SegmentBy); err != nil {
+		return nil, err
+	}
+	e := &extractor{types: map[int]struct{}{sch.PurchaseEventTypeID: {}}, purchase: sch.PurchaseEventTypeID}
+	for _, id := range cfg.RefundEventTypeIDs {
+		e.types[id] = struct{}{}
+	}
+	var err error
+	if e.price, err = parsePath(sch.PricePath); err != nil {
+		return nil, err
+	}
+	if cfg.Currency != nil {
+		if e.currency, err = parsePath(sch.CurrencyPath); err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range cfg.SegmentBy {
+		steps, err := parsePath(p)
+		if err != nil {
+			return nil, err
+		}
+		e.segments = append(e.segments, steps)
+	}
+	return e, nil
+}
+
+// accepts indique si la ligne est un achat ou un remboursement configuré.
+func (e *extractor) accepts(r record) bool {
+	_, ok := e.types[r.EventTypeID]
+	return ok
+}
+
+// event construit l'événement de r, champs du Digest compris.
+func (e *extractor) event(r record) (models.RawEventData, error) {
+	ev := models.RawEventData{
+		EventID:     r.EventID,
+		CustomerID:  r.CustomerID,
+		EventTypeID: r.EventTypeID,
+		EventDate:   r.EventDate,
+		Quantity:    r.Quantity,
+	}
+	doc, err := parseDigest(r.Digest)
+	if err != nil {
+		return ev, fmt.Errorf("event %d: Digest: %w", r.EventID, err)
+	}
+	price, _ := lookup(doc, e.price)
+	ev.UnitPrice = moneyOf(price)
+	if e.currency != nil {
+		ev.Currency = textOf(lookup(doc, e.currency))
+	}
+	if len(e.segments) > 0 {
+		ev.Segments = make([]string, len(e.segments))
+		for i, steps := range e.segments {
+			ev.Segments[i] = textOf(lookup(doc, steps))
+		}
+	}
+	return ev, nil
+}
+
+// stream transmet à fn les événements d'achat et de remboursement dont EventDate est dans [from, to)
+// (from nul : pas de borne basse) et pour lesquels keep renvoie vrai (nil : tous).
+func (s *Source) stream(ctx context.Context, from, to time.Time, keep func(record) bool, cfg models.Config, fn func(models.RawEventData) error) error {
+	e, err := newExtractor(cfg)
+	if err != nil {
+		return err
+	}
+	n := 0
+	_, err = scanFile(ctx, s.Path, s.format, func(r record) error {
+		if !e.accepts(r) || !r.EventDate.Before(to) || r.EventDate.Before(from) || (keep != nil && !keep(r)) {
+			return nil
+		}
+		ev, err := e.event(r)
+		if err != nil {
+			return err
+		}
+		n++
+		return fn(ev)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.Path, err)
+	}
+	if cfg.Verbose {
+		log.Printf("[INFO] [LOAD] %s: %d events", s.Path, n)
+	}
+	return nil
+}
+
+func (s *Source) LoadOrderEvents(ctx context.Context, obsBefore time.Time, cfg models.Config) ([]models.RawEventData, error) {
+	out := make([]models.RawEventData, 0, 1024)
+	err := s.StreamOrderEvents(ctx, obsBefore, cfg, func(ev models.RawEventData) error {
+		out = append(out, ev)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *Source) StreamOrderEvents(ctx context.Context, obsBefore time.Time, cfg models.Config, fn func(models.RawEventData) error) error {
+	return s.stream(ctx, time.Time{}, obsBefore, nil, cfg, fn)
+}
+
+// LoadOrdersInsertDate lit la colonne InsertDate des événements fournis ; elle doit exister dans l'extrait.
+func (s *Source) LoadOrdersInsertDate(ctx context.Context, events []models.RawEventData, obsBefore time.Time, cfg models.Config) ([]models.RawEventsInsertDate, error) {
+	ids := make(map[uint64]struct{}, len(events))
+	for _, ev := range events {
+		ids[ev.EventID] = struct{}{}
+	}
+	var out []models.RawEventsInsertDate
+	hasInsertDate, err := scanFile(ctx, s.Path, s.format, func(r record) error {
+		if _, ok := ids[r.EventID]; ok && !r.InsertDate.IsZero() && r.InsertDate.Before(obsBefore) {
+			out = append(out, models.RawEventsInsertDate{EventID: r.EventID, InsertDate: r.InsertDate})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.Path, err)
+	}
+	if !hasInsertDate {
+		return nil, fmt.Errorf("%s: colonne InsertDate absente, nécessaire au mode %s", s.Path, calculator.ModeWithInsertDate)
+	}
+	return out, nil
+}
+
+// LoadCohortCustomers renvoie, comme la requête SQL, les clients dont le premier achat antérieur
+// à min(cohortEnd, cfg.Observation) est dans [cohortStart, cohortEnd).
+func (s *Source) LoadCohortCustomers(ctx context.Context, cohortStart, cohortEnd time.Time, cfg models.Config) ([]models.CohortCustomer, error) {
+	bound := cohortEnd
+	if !cfg.Observation.IsZero() && cfg.Observation.Before(bound) {
+		bound = cfg.Observation
+	}
+	purchase := database.ResolveSchema(cfg.Schema).PurchaseEventTypeID
+	first := make(map[uint64]time.Time)
+	_, err := scanFile(ctx, s.Path, s.format, func(r record) error {
+		if r.EventTypeID != purchase || !r.EventDate.Before(bound) {
+			return nil
+		}
+		if t, ok := first[r.CustomerID]; !ok || r.EventDate.Before(t) {
+			first[r.CustomerID] = r.EventDate
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.Path, err)
+	}
+	out := make([]models.CohortCustomer, 0, len(first))
+	for id, t := range first {
+		if !t.Before(cohortStart) {
+			out = append(out, models.CohortCustomer{CustomerID: id, FirstOrderDT: t})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CustomerID < out[j].CustomerID })
+	return out, nil
+}
+
+func (s *Source) LoadOrderEventsWithCustomersID(ctx context.Context, customers []models.CohortCustomer, obsBefore time.Time, cfg models.Config) ([]models.RawEventData, error) {
+	var out []models.RawEventData
+	err := s.StreamOrderEventsWithCustomersID(ctx, customers, obsBefore, cfg, func(ev models.RawEventData) error {
+		out = append(out, ev)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// StreamOrderEventsWithCustomersID implémente calculator.CustomerEventStreamer.
+func (s *Source) StreamOrderEventsWithCustomersID(ctx context.Context, customers []models.CohortCustomer, obsBefore time.Time, cfg models.Config, fn func(models.RawEventData) error) error {
+	ids := make(map[uint64]struct{}, len(customers))
+	for _, c := range customers {
+		ids[c.CustomerID] = struct{}{}
+	}
+	return s.stream(ctx, time.Time{}, obsBefore, func(r record) bool {
+		_, ok := ids[r.CustomerID]
+		return ok
+	}, cfg, fn)
+}
+
+// StreamOrderEventsWithInsertDate implémente calculator.InsertDateStreamer : EventDate est remplacée par
+// la colonne InsertDate de la même ligne si elle est antérieure à obsBefore ; la colonne doit exister.
+func (s *Source) StreamOrderEventsWithInsertDate(ctx context.Context, obsBefore time.Time, cfg models.Config, fn func(models.RawEventData) error) error {
+	e, err := newExtractor(cfg)
+	if err != nil {
+		return err
+	}
+	hasInsertDate, err := scanFile(ctx, s.Path, s.format, func(r record) error {
+		if !e.accepts(r) || !r.EventDate.Before(obsBefore) {
+			return nil
+		}
+		ev, err := e.event(r)
+		if err != nil {
+			return err
+		}
+		if !r.InsertDate.IsZero() && r.InsertDate.Before(obsBefore) {
+			ev.EventDate = r.InsertDate
+		}
+		return fn(ev)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.Path, err)
+	}
+	if !hasInsertDate {
+		return fmt.Errorf("%s: colonne InsertDate absente, nécessaire au mode %s", s.Path, calculator.ModeWithInsertDate)
+	}
+	return nil
+}
+
+// StreamOrderEventsBetween et CountOrderEvents implémentent calculator.IncrementalSource.
+func (s *Source) StreamOrderEventsBetween(ctx context.Context, from, to time.Time, cfg models.Config, fn func(models.RawEventData) error) error {
+	return s.stream(ctx, from, to, nil, cfg, fn)
+}
+
+func (s *Source) CountOrderEvents(ctx context.Context, before time.Time, cfg models.Config) (int, error) {
+	e, err := newExtractor(cfg)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	_, err = scanFile(ctx, s.Path, s.format, func(r record) error {
+		if e.accepts(r) && r.EventDate.Before(before) {
+			n++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", s.Path, err)
+	}
+	return n, nil
+}
+
+// AggregateCohorts implémente calculator.CohortAggregator (mode pushdown) : le fichier est agrégé
+// en mémoire avec les règles de Run, faute de moteur de requête.
+func (s *Source) AggregateCohorts(ctx context.Context, cohortStart, cohortEnd time.Time, cfg models.Config) ([]models.CohortAggregate, error) {
+	return calculator.AggregateInMemory(ctx, s, cohortStart, cohortEnd, cfg)
+}
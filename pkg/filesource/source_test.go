@@ -0,0 +1,357 @@
+package filesource
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"ltv-monthly/pkg/calculator"
+	"ltv-monthly/pkg/models"
+)
+
+// row est une ligne de l'extrait de test ; Quantity nil = NULL.
+type row struct {
+	EventID     int64     `parquet:"EventID"`
+	CustomerID  int64     `parquet:"CustomerID"`
+	EventTypeID int32     `parquet:"EventTypeID"`
+	EventDate   time.Time `parquet:"EventDate,timestamp(millisecond)"`
+	Quantity    *int64    `parquet:"Quantity,optional"`
+	Digest      string    `parquet:"Digest"`
+	InsertDate  time.Time `parquet:"InsertDate,timestamp(millisecond)"`
+}
+
+func day(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+
+func qty(n int64) *int64 { return &n }
+
+// fixtureRows : clients 1 et 2 en janvier, client 3 en février ; un remboursement (type 7), un événement
+// hors commande (type 3) et un achat postérieur à l'observation, ignorés dans le calcul de base.
+func fixtureRows() []row {
+	return []row{
+		{1, 1, 6, day(2025, 1, 5), qty(1), `{"price":{"originalUnitPrice":10},"channel":"web"}`, day(2025, 1, 5)},
+		{2, 1, 6, day(2025, 2, 5), qty(2), `{"price":{"originalUnitPrice":"5.00"},"channel":"web"}`, day(2025, 2, 6)},
+		{3, 2, 6, day(2025, 1, 20), nil, `{"price":{"originalUnitPrice":30},"channel":"store"}`, day(2025, 3, 2)},
+		{4, 3, 6, day(2025, 2, 1), qty(1), `{"price":{"originalUnitPrice":7}}`, day(2025, 2, 1)},
+		{5, 3, 6, day(2025, 4, 1), qty(1), `{"price":{"originalUnitPrice":100}}`, day(2025, 4, 1)},
+		{6, 2, 7, day(2025, 1, 25), qty(1), `{"price":{"originalUnitPrice":-10}}`, day(2025, 1, 25)},
+		{7, 1, 3, day(2025, 1, 6), qty(1), `{}`, day(2025, 1, 6)},
+	}
+}
+
+func fixtureConfig() models.Config {
+	return models.Config{
+		StartMonthInclusive: "012025",
+		EndMonthInclusive:   "022025",
+		Observation:         day(2025, 3, 1),
+		Granularity:         "month",
+	}
+}
+
+func writeCSV(t *testing.T, path string, rows []row, withInsertDate bool) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	header := []string{"EventID", "CustomerID", "EventTypeID", "EventDate", "Quantity", "Digest"}
+	if withInsertDate {
+		header = append(header, "InsertDate")
+	}
+	w.Write(header)
+	for _, r := range rows {
+		q := ""
+		if r.Quantity != nil {
+			q = strconv.FormatInt(*r.Quantity, 10)
+		}
+		rec := []string{strconv.FormatInt(r.EventID, 10), strconv.FormatInt(r.CustomerID, 10), strconv.Itoa(int(r.EventTypeID)),
+			r.EventDate.Format("2006-01-02 15:04:05"), q, r.Digest}
+		if withInsertDate {
+			rec = append(rec, r.InsertDate.Format("2006-01-02 15:04:05"))
+		}
+		w.Write(rec)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeJSONL(t *testing.T, path string, rows []row) {
+	t.Helper()
+	var b strings.Builder
+	for _, r := range rows {
+		obj := map[string]any{
+			"eventId": r.EventID, "customerId": r.CustomerID, "eventTypeId": r.EventTypeID,
+			"eventDate": r.EventDate.Format(time.RFC3339), "Digest": json.RawMessage(r.Digest),
+			"insertDate": r.InsertDate.Format(time.RFC3339),
+		}
+		if r.Quantity != nil {
+			obj["quantity"] = *r.Quantity
+		}
+		line, err := json.Marshal(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeParquet(t *testing.T, path string, rows []row) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := parquet.NewGenericWriter[row](f)
+	if _, err := w.Write(rows); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fixtureSources écrit l'extrait dans les trois formats.
+func fixtureSources(t *testing.T) map[string]*Source {
+	t.Helper()
+	dir := t.TempDir()
+	writeCSV(t, filepath.Join(dir, "events.csv"), fixtureRows(), true)
+	writeJSONL(t, filepath.Join(dir, "events.jsonl"), fixtureRows())
+	writeParquet(t, filepath.Join(dir, "events.parquet"), fixtureRows())
+
+	out := make(map[string]*Source)
+	for _, name := range []string{"events.csv", "events.jsonl", "events.parquet"} {
+		src, err := Open("file://" + filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("Open(%s): unexpected error: %v", name, err)
+		}
+		out[name] = src
+	}
+	return out
+}
+
+func TestRun_AllFormats(t *testing.T) {
+	eur := func(v float64) models.Money { return models.MoneyFromFloat(v) }
+	for name, src := range fixtureSources(t) {
+		got, err := calculator.Run(context.Background(), src, fixtureConfig())
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if len(got) != 2 {
+			t.Fatalf("%s: got %d results, want 2", name, len(got))
+		}
+		// 01/2025: clients 1 (10+10) et 2 (30, Quantity NULL → 1) → 50/2
+		if got[0].MonthYear != "01/2025" || got[0].CohortClients != 2 || got[0].EventsRead != 3 || got[0].LTVAvg != eur(25) {
+			t.Fatalf("%s: unexpected 01/2025 result: %+v", name, got[0])
+		}
+		if got[1].MonthYear != "02/2025" || got[1].CohortClients != 1 || got[1].EventsRead != 1 || got[1].LTVAvg != eur(7) {
+			t.Fatalf("%s: unexpected 02/2025 result: %+v", name, got[1])
+		}
+	}
+}
+
+func TestRunners_MatchRun(t *testing.T) {
+	cfg := fixtureConfig()
+	cfg.RefundEventTypeIDs = []int{7}
+	for name, src := range fixtureSources(t) {
+		want, err := calculator.Run(context.Background(), src, cfg)
+		if err != nil {
+			t.Fatalf("%s: Run: unexpected error: %v", name, err)
+		}
+		if want[0].RefundsAvg != models.MoneyFromFloat(5) {
+			t.Fatalf("%s: refunds: got %v, want 5", name, want[0].RefundsAvg)
+		}
+		for _, mode := range []string{calculator.ModeRamOptimized, calculator.ModePushdown} {
+			run, err := calculator.RunnerFor(mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := run(context.Background(), src, cfg)
+			if err != nil {
+				t.Fatalf("%s/%s: unexpected error: %v", name, mode, err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("%s/%s: results differ:\n got %+v\nwant %+v", name, mode, got, want)
+			}
+		}
+	}
+}
+
+func TestStreamingMatchesLoad(t *testing.T) {
+	cfg := fixtureConfig()
+	cfg.RefundEventTypeIDs = []int{7}
+	for name, src := range fixtureSources(t) {
+		opaque := struct{ calculator.EventSource }{src} // sans CustomerEventStreamer ni InsertDateStreamer
+		for _, mode := range []string{calculator.ModeRamOptimized, calculator.ModeWithInsertDate} {
+			run, err := calculator.RunnerFor(mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := run(context.Background(), opaque, cfg)
+			if err != nil {
+				t.Fatalf("%s/%s/load: unexpected error: %v", name, mode, err)
+			}
+			got, err := run(context.Background(), src, cfg)
+			if err != nil {
+				t.Fatalf("%s/%s/stream: unexpected error: %v", name, mode, err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("%s/%s: results differ:\n got %+v\nwant %+v", name, mode, got, want)
+			}
+		}
+	}
+}
+
+func TestRun_Segments(t *testing.T) {
+	cfg := fixtureConfig()
+	cfg.SegmentBy = []string{"$.channel"}
+	for name, src := range fixtureSources(t) {
+		got, err := calculator.Run(context.Background(), src, cfg)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		seen := make(map[string]int)
+		for _, r := range got {
+			seen[r.MonthYear+"/"+r.Segments["$.channel"]] = r.CohortClients
+		}
+		want := map[string]int{"01/2025/web": 1, "01/2025/store": 1, "02/2025/": 1}
+		if !reflect.DeepEqual(seen, want) {
+			t.Fatalf("%s: segments: got %v, want %v", name, seen, want)
+		}
+	}
+}
+
+func TestLoadOrdersInsertDate(t *testing.T) {
+	for name, src := range fixtureSources(t) {
+		evs, err := src.LoadOrderEvents(context.Background(), day(2025, 3, 1), fixtureConfig())
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		got, err := src.LoadOrdersInsertDate(context.Background(), evs, day(2025, 3, 1), fixtureConfig())
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		// l'événement 3 est inséré après l'observation
+		if len(got) != 3 {
+			t.Fatalf("%s: got %d insert dates, want 3: %+v", name, len(got), got)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "events.csv")
+	writeCSV(t, path, fixtureRows(), false)
+	src, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.LoadOrdersInsertDate(context.Background(), nil, day(2025, 3, 1), fixtureConfig()); err == nil {
+		t.Fatal("expected error without InsertDate column, got nil")
+	}
+	if _, err := calculator.RunWithInsertDateFromCustomerEvent(context.Background(), src, fixtureConfig()); err == nil {
+		t.Fatal("expected error without InsertDate column in withInsertDate mode, got nil")
+	}
+}
+
+// TestCanceledContext vérifie que chaque lecture de l'extrait s'arrête avec l'erreur du contexte annulé.
+func TestCanceledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cfg := fixtureConfig()
+	obs := day(2025, 3, 1)
+	for name, src := range fixtureSources(t) {
+		noop := func(models.RawEventData) error { return nil }
+		calls := map[string]func() error{
+			"StreamOrderEvents": func() error { return src.StreamOrderEvents(ctx, obs, cfg, noop) },
+			"StreamOrderEventsWithInsertDate": func() error {
+				return src.StreamOrderEventsWithInsertDate(ctx, obs, cfg, noop)
+			},
+			"LoadOrdersInsertDate": func() error {
+				_, err := src.LoadOrdersInsertDate(ctx, nil, obs, cfg)
+				return err
+			},
+			"LoadCohortCustomers": func() error {
+				_, err := src.LoadCohortCustomers(ctx, day(2025, 1, 1), obs, cfg)
+				return err
+			},
+			"CountOrderEvents": func() error {
+				_, err := src.CountOrderEvents(ctx, obs, cfg)
+				return err
+			},
+			"AggregateCohorts": func() error {
+				_, err := src.AggregateCohorts(ctx, day(2025, 1, 1), obs, cfg)
+				return err
+			},
+		}
+		for call, fn := range calls {
+			if err := fn(); !errors.Is(err, context.Canceled) {
+				t.Fatalf("%s/%s: got %v, want context.Canceled", name, call, err)
+			}
+		}
+	}
+}
+
+func TestOpen_Errors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := Open("file://" + filepath.Join(dir, "events.xlsx")); err == nil {
+		t.Fatal("expected error for an unknown extension, got nil")
+	}
+	if _, err := Open("file://" + filepath.Join(dir, "missing.csv")); err == nil {
+		t.Fatal("expected error for a missing file, got nil")
+	}
+
+	path := filepath.Join(dir, "events.csv")
+	if err := os.WriteFile(path, []byte("EventID,CustomerID,EventDate\n1,1,2025-01-01\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	src, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = src.LoadOrderEvents(context.Background(), day(2025, 3, 1), fixtureConfig())
+	if err == nil || !strings.Contains(err.Error(), "EventTypeID") || !strings.Contains(err.Error(), "Digest") {
+		t.Fatalf("expected missing columns error, got %v", err)
+	}
+}
+
+func TestDigestPaths(t *testing.T) {
+	doc, err := parseDigest([]byte(`{"price":{"originalUnitPrice":"12.50"},"items":[{"sku":"A"},{"sku":7}],"flag":true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]string{
+		"$.items[0].sku": "A",
+		"$.items[1].sku": "7",
+		"$.flag":         "true",
+		"$.items[5].sku": "",
+		"$.missing":      "",
+	} {
+		steps, err := parsePath(path)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", path, err)
+		}
+		if got := textOf(lookup(doc, steps)); got != want {
+			t.Fatalf("%s: got %q, want %q", path, got, want)
+		}
+	}
+	steps, _ := parsePath("$.price.originalUnitPrice")
+	price, _ := lookup(doc, steps)
+	if got := moneyOf(price); got != models.MoneyFromFloat(12.5) {
+		t.Fatalf("price: got %v, want 12.50", got)
+	}
+}
@@ -0,0 +1,159 @@
+package fx
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"ltv-monthly/pkg/models"
+)
+
+// Table contient les taux de change vers une devise de reporting, par devise et par date d'effet.
+// Un taux s'applique de sa date jusqu'au taux suivant de la même devise : une table journalière,
+// mensuelle ou ne contenant que les changements de taux convient.
+// Table implémente models.CurrencyConverter.
+type Table struct {
+	reporting string
+	rates     map[string][]rate // devise → taux triés par date d'effet
+}
+
+type rate struct {
+	from  time.Time
+	value *big.Rat // unités de devise de reporting pour 1 unité de devise
+}
+
+// NewTable crée une table vide vers la devise de reporting (code ISO 4217, ex: "EUR").
+func NewTable(reporting string) (*Table, error) {
+	code, err := normalizeCode(reporting)
+	if err != nil {
+		return nil, err
+	}
+	return &Table{reporting: code, rates: make(map[string][]rate, 8)}, nil
+}
+
+// Reporting renvoie la devise de reporting.
+func (t *Table) Reporting() string {
+	return t.reporting
+}
+
+// Add enregistre le taux (décimal, ex: "1.1712") d'une devise à partir de la date from.
+// Un second taux pour la même (devise, date) remplace le premier.
+func (t *Table) Add(currency string, from time.Time, value string) error {
+	code, err := normalizeCode(currency)
+	if err != nil {
+		return err
+	}
+	v, ok := new(big.Rat).SetString(strings.TrimSpace(value))
+	if !ok || v.Sign() <= 0 {
+		return fmt.Errorf("fx: taux invalide %q pour %s", value, code)
+	}
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+
+	rs := t.rates[code]
+	i := sort.Search(len(rs), func(i int) bool { return !rs[i].from.Before(from) })
+	if i < len(rs) && rs[i].from.Equal(from) {
+		rs[i].value = v
+		return nil
+	}
+	rs = append(rs, rate{})
+	copy(rs[i+1:], rs[i:])
+	rs[i] = rate{from: from, value: v}
+	t.rates[code] = rs
+	return nil
+}
+
+// Currencies renvoie les devises ayant au moins un taux, triées.
+func (t *Table) Currencies() []string {
+	out := make([]string, 0, len(t.rates))
+	for c := range t.rates {
+		out = append(out, c)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Convert convertit amount, exprimé en currency, dans la devise de reporting au dernier taux
+// dont la date d'effet est <= at. La devise de reporting est convertie à l'identique.
+// ok = false si la devise est inconnue ou sans taux à cette date ; erreur si le montant converti dépasse la capacité de Money.
+func (t *Table) Convert(amount models.Money, currency string, at time.Time, mode models.RoundingMode) (models.Money, bool, error) {
+	code, err := normalizeCode(currency)
+	if err != nil {
+		return 0, false, nil
+	}
+	if code == t.reporting {
+		return amount, true, nil
+	}
+	rs := t.rates[code]
+	at = at.UTC()
+	i := sort.Search(len(rs), func(i int) bool { return rs[i].from.After(at) })
+	if i == 0 {
+		return 0, false, nil
+	}
+	v, err := amount.MulRat(rs[i-1].value, mode)
+	if err != nil {
+		return 0, false, fmt.Errorf("conversion %s → %s: %w", code, t.reporting, err)
+	}
+	return v, true, nil
+}
+
+// ReadCSV lit une table de taux au format "date,currency,rate" (date YYYY-MM-DD, en-tête facultatif).
+// rate est le nombre d'unités de la devise de reporting pour 1 unité de currency.
+func ReadCSV(r io.Reader, reporting string) (*Table, error) {
+	t, err := NewTable(reporting)
+	if err != nil {
+		return nil, err
+	}
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 3
+	cr.TrimLeadingSpace = true
+	for line := 1; ; line++ {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("fx: %w", err)
+		}
+		if line == 1 && strings.EqualFold(strings.TrimSpace(rec[0]), "date") {
+			continue
+		}
+		d, err := time.Parse("2006-01-02", strings.TrimSpace(rec[0]))
+		if err != nil {
+			return nil, fmt.Errorf("fx: ligne %d: date invalide %q (attendu YYYY-MM-DD)", line, rec[0])
+		}
+		if err := t.Add(rec[1], d, rec[2]); err != nil {
+			return nil, fmt.Errorf("ligne %d: %w", line, err)
+		}
+	}
+	return t, nil
+}
+
+// LoadCSV lit la table de taux du fichier path (voir ReadCSV).
+func LoadCSV(path, reporting string) (*Table, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadCSV(f, reporting)
+}
+
+// normalizeCode valide un code devise à 3 lettres et le met en majuscules.
+func normalizeCode(code string) (string, error) {
+	c := strings.ToUpper(strings.TrimSpace(code))
+	if len(c) != 3 {
+		return "", fmt.Errorf("fx: code devise invalide %q (attendu ISO 4217, ex: EUR)", code)
+	}
+	for _, r := range c {
+		if r < 'A' || r > 'Z' {
+			return "", fmt.Errorf("fx: code devise invalide %q (attendu ISO 4217, ex: EUR)", code)
+		}
+	}
+	return c, nil
+}
@@ -0,0 +1,62 @@
+package fx
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"ltv-monthly/pkg/models"
+)
+
+func day(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestReadCSV_Convert(t *testing.T) {
+	in := "date,currency,rate\n2025-01-01,GBP,1.20\n2025-02-01,gbp,1.25\n2025-01-01,CHF,1.05\n"
+	tbl, err := ReadCSV(strings.NewReader(in), "eur")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ten := models.MoneyFromFloat(10)
+	cases := []struct {
+		currency string
+		at       time.Time
+		want     models.Money
+		ok       bool
+	}{
+		{"EUR", day(2020, 1, 1), ten, true},
+		{"GBP", day(2025, 1, 31), models.MoneyFromFloat(12), true},
+		{"GBP", day(2025, 2, 1).Add(time.Hour), models.MoneyFromFloat(12.5), true},
+		{"CHF", day(2025, 3, 1), models.MoneyFromFloat(10.5), true},
+		{"GBP", day(2024, 12, 31), 0, false}, // avant le premier taux
+		{"USD", day(2025, 1, 15), 0, false},  // devise inconnue
+		{"", day(2025, 1, 15), 0, false},     // devise absente
+	}
+	for _, tc := range cases {
+		got, ok, err := tbl.Convert(ten, tc.currency, tc.at, models.RoundHalfEven)
+		if err != nil || got != tc.want || ok != tc.ok {
+			t.Fatalf("%q at %s: got (%s, %v), want (%s, %v)", tc.currency, tc.at.Format("2006-01-02"), got, ok, tc.want, tc.ok)
+		}
+	}
+	if got := strings.Join(tbl.Currencies(), ","); got != "CHF,GBP" {
+		t.Fatalf("currencies: got %q", got)
+	}
+}
+
+func TestReadCSV_Errors(t *testing.T) {
+	for _, in := range []string{
+		"2025-01-01,GBP,abc\n",
+		"2025-01-01,GBP,-1\n",
+		"01/2025,GBP,1.2\n",
+		"2025-01-01,POUND,1.2\n",
+		"2025-01-01,GBP\n",
+	} {
+		if _, err := ReadCSV(strings.NewReader(in), "EUR"); err == nil {
+			t.Fatalf("%q: expected error, got nil", in)
+		}
+	}
+	if _, err := NewTable("euro"); err == nil {
+		t.Fatal("expected error for invalid reporting currency, got nil")
+	}
+}
@@ -0,0 +1,329 @@
+// Package gen génère des clients et des événements d'achat synthétiques réalistes (courbe
+// d'acquisition, attrition, distribution des paniers, remboursements, délai d'insertion),
+// déterministes pour une graine donnée, au format des tables CustomerEventData et CustomerEvent.
+package gen
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"ltv-monthly/pkg/models"
+)
+
+// Params décrit la population et le comportement d'achat simulés.
+type Params struct {
+	Seed      int64
+	Customers int       // nombre de clients acquis
+	Start     time.Time // premier mois d'acquisition (tronqué au mois, UTC)
+	Months    int       // nombre de mois d'acquisition
+	Until     time.Time // borne exclusive des événements ; zéro = Start + Months + 12 mois
+
+	Growth      float64 // croissance mensuelle des acquisitions (0.05 = +5 % par mois)
+	Seasonality float64 // amplitude de la saisonnalité annuelle des acquisitions, dans [0, 1)
+
+	Churn          float64 // probabilité mensuelle d'attrition après le mois d'acquisition
+	OrdersPerMonth float64 // nombre moyen de commandes par mois actif, hors première commande (Poisson)
+	OrderValue     float64 // prix unitaire moyen (loi lognormale)
+	OrderSigma     float64 // écart-type du logarithme du prix unitaire
+
+	RefundRate   float64       // part des commandes remboursées
+	RefundTypeID int           // EventTypeID des remboursements
+	InsertSkew   time.Duration // délai moyen (exponentiel) entre EventDate et InsertDate ; 0 = insertion immédiate
+
+	Channels  []string // valeurs de $.channel, tirées une fois par client ; vide = absent
+	Countries []string // valeurs de $.country, tirées une fois par client ; vide = absent
+	Currency  string   // devise écrite au chemin Schema.CurrencyPath ; vide = absente
+
+	Schema models.Schema // EventTypeID des achats et chemins du prix et de la devise dans Digest
+}
+
+// Stats résume les événements générés.
+type Stats struct {
+	Customers int // clients ayant commandé : moins que Params.Customers si Until coupe le dernier mois d'acquisition
+	Orders    int
+	Refunds   int
+	Revenue   models.Money // somme des commandes (prix unitaire × quantité), remboursements non déduits
+}
+
+// labelRe restreint les libellés écrits dans Digest : ni apostrophe ni barre oblique inverse,
+// le JSON est ainsi un littéral SQL valide quel que soit le dialecte.
+var labelRe = regexp.MustCompile(`^[A-Za-z0-9 _.-]+$`)
+
+// keyPathRe : chemins JSON sans index, seuls à pouvoir être construits dans Digest.
+var keyPathRe = regexp.MustCompile(`^\$(\.[A-Za-z_][A-Za-z0-9_]*)+$`)
+
+// maxOrdersPerMonth borne la moyenne de la loi de Poisson (tirage par produit d'uniformes).
+const maxOrdersPerMonth = 30
+
+// withDefaults complète p et vérifie sa cohérence.
+func (p Params) withDefaults() (Params, error) {
+	if p.Customers <= 0 || p.Months <= 0 {
+		return p, fmt.Errorf("customers et months doivent être positifs")
+	}
+	if p.Start.IsZero() {
+		return p, fmt.Errorf("mois de début manquant")
+	}
+	p.Start = time.Date(p.Start.Year(), p.Start.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if p.Until.IsZero() {
+		p.Until = p.Start.AddDate(0, p.Months+12, 0)
+	}
+	p.Until = p.Until.UTC()
+	if !p.Until.After(p.Start.AddDate(0, p.Months-1, 0)) {
+		return p, fmt.Errorf("until (%s) doit suivre le dernier mois d'acquisition", p.Until.Format("2006-01-02"))
+	}
+	switch {
+	case p.Growth <= -1:
+		return p, fmt.Errorf("growth doit être supérieur à -1")
+	case p.Seasonality < 0 || p.Seasonality >= 1:
+		return p, fmt.Errorf("seasonality doit être dans [0, 1)")
+	case p.Churn < 0 || p.Churn > 1:
+		return p, fmt.Errorf("churn doit être dans [0, 1]")
+	case p.OrdersPerMonth < 0 || p.OrdersPerMonth > maxOrdersPerMonth:
+		return p, fmt.Errorf("orders_per_month doit être dans [0, %d]", maxOrdersPerMonth)
+	case p.OrderValue <= 0 || p.OrderSigma < 0:
+		return p, fmt.Errorf("order_value doit être positif et order_sigma positif ou nul")
+	case p.RefundRate < 0 || p.RefundRate > 1:
+		return p, fmt.Errorf("refund_rate doit être dans [0, 1]")
+	case p.InsertSkew < 0:
+		return p, fmt.Errorf("insert_skew doit être positif ou nul")
+	}
+	for _, l := range slices.Concat(p.Channels, p.Countries) {
+		if !labelRe.MatchString(l) {
+			return p, fmt.Errorf("libellé invalide %q", l)
+		}
+	}
+	if p.Currency != "" && !labelRe.MatchString(p.Currency) {
+		return p, fmt.Errorf("devise invalide %q", p.Currency)
+	}
+
+	p.Schema = resolveSchema(p.Schema)
+	for _, path := range []string{p.Schema.PricePath, p.Schema.CurrencyPath} {
+		if !keyPathRe.MatchString(path) {
+			return p, fmt.Errorf("chemin JSON %q : seuls les chemins de clés ($.a.b) sont générés", path)
+		}
+	}
+	if p.Schema.PricePath == p.Schema.CurrencyPath || strings.HasPrefix(p.Schema.CurrencyPath, p.Schema.PricePath+".") ||
+		strings.HasPrefix(p.Schema.PricePath, p.Schema.CurrencyPath+".") {
+		return p, fmt.Errorf("chemins du prix et de la devise incompatibles")
+	}
+	if p.RefundRate > 0 && p.RefundTypeID == p.Schema.PurchaseEventTypeID {
+		return p, fmt.Errorf("refund_type doit différer du type des achats")
+	}
+	return p, nil
+}
+
+// resolveSchema complète les valeurs par défaut de s utilisées par le générateur
+// (mêmes défauts que database.ResolveSchema).
+func resolveSchema(s models.Schema) models.Schema {
+	if s.PurchaseEventTypeID == 0 {
+		s.PurchaseEventTypeID = 6
+	}
+	if s.PricePath == "" {
+		s.PricePath = "$.price.originalUnitPrice"
+	}
+	if s.CurrencyPath == "" {
+		s.CurrencyPath = "$.price.currency"
+	}
+	return s
+}
+
+// Generate simule la population décrite par p et passe chaque événement à fn, client par client
+// (par mois d'acquisition puis CustomerID croissants), dans l'ordre chronologique de chaque client.
+// EventID et CustomerID sont séquentiels à partir de 1. Les événements sont tous antérieurs à p.Until ;
+// leur date d'insertion peut lui être postérieure. Une erreur de fn interrompt la génération.
+func Generate(p Params, fn func(models.EventRecord) error) (Stats, error) {
+	p, err := p.withDefaults()
+	if err != nil {
+		return Stats{}, err
+	}
+	g := generator{p: p, rng: rand.New(rand.NewSource(p.Seed))}
+
+	var (
+		stats      Stats
+		customerID uint64
+		events     []models.EventRecord
+	)
+	for m, n := range g.acquisitions() {
+		month := p.Start.AddDate(0, m, 0)
+		for i := 0; i < n; i++ {
+			// un client dont la première commande tombe après Until n'existe pas : les CustomerID restent contigus
+			if events, err = g.customer(events[:0], customerID+1, month, &stats); err != nil {
+				return stats, err
+			}
+			if len(events) == 0 {
+				continue
+			}
+			customerID++
+			for _, e := range events {
+				g.eventID++
+				e.EventID = g.eventID
+				if err := fn(e); err != nil {
+					return stats, err
+				}
+			}
+		}
+	}
+	stats.Customers = int(customerID)
+	return stats, nil
+}
+
+type generator struct {
+	p       Params
+	rng     *rand.Rand
+	eventID uint64
+}
+
+// acquisitions répartit p.Customers entre les mois d'acquisition, au prorata d'une tendance
+// géométrique (Growth) modulée par une saisonnalité annuelle sinusoïdale (pic en avril).
+func (g *generator) acquisitions() []int {
+	weights := make([]float64, g.p.Months)
+	var total float64
+	for m := range weights {
+		calendar := float64(g.p.Start.AddDate(0, m, 0).Month() - 1)
+		weights[m] = math.Pow(1+g.p.Growth, float64(m)) * (1 + g.p.Seasonality*math.Sin(2*math.Pi*calendar/12))
+		total += weights[m]
+	}
+	counts := make([]int, g.p.Months)
+	for i := 0; i < g.p.Customers; i++ {
+		r := g.rng.Float64() * total
+		m := 0
+		for ; m < len(weights)-1 && r >= weights[m]; m++ {
+			r -= weights[m]
+		}
+		counts[m]++
+	}
+	return counts
+}
+
+// customer ajoute à events (vide) l'historique d'un client acquis pendant month : première commande dans le
+// mois, puis chaque mois suivant, tant qu'il n'a pas attrité, un nombre de commandes tiré d'une loi de
+// Poisson ; chaque commande peut être suivie d'un remboursement dans les 30 jours.
+func (g *generator) customer(events []models.EventRecord, customerID uint64, month time.Time, stats *Stats) ([]models.EventRecord, error) {
+	labels := make(map[string]string)
+	if len(g.p.Channels) > 0 {
+		labels["channel"] = g.p.Channels[g.rng.Intn(len(g.p.Channels))]
+	}
+	if len(g.p.Countries) > 0 {
+		labels["country"] = g.p.Countries[g.rng.Intn(len(g.p.Countries))]
+	}
+
+	var orders []time.Time
+	if first := g.within(month); first.Before(g.p.Until) {
+		orders = append(orders, first)
+	}
+	for m := month.AddDate(0, 1, 0); m.Before(g.p.Until); m = m.AddDate(0, 1, 0) {
+		if g.rng.Float64() < g.p.Churn {
+			break
+		}
+		for n := g.poisson(g.p.OrdersPerMonth); n > 0; n-- {
+			if t := g.within(m); t.Before(g.p.Until) {
+				orders = append(orders, t)
+			}
+		}
+	}
+	slices.SortFunc(orders, func(a, b time.Time) int { return a.Compare(b) })
+
+	for _, date := range orders {
+		price := g.price()
+		qty := g.quantity()
+		events = append(events, g.record(customerID, g.p.Schema.PurchaseEventTypeID, date, qty, price, labels))
+		stats.Orders++
+		amount, err := models.MoneyFromFloat(price).Mul(qty)
+		if err != nil {
+			return nil, fmt.Errorf("customer %d: %w", customerID, err)
+		}
+		stats.Revenue += amount
+
+		if g.p.RefundRate > 0 && g.rng.Float64() < g.p.RefundRate {
+			refund := date.Add(time.Duration(1+g.rng.Intn(30*24*3600)) * time.Second)
+			if refund.Before(g.p.Until) {
+				events = append(events, g.record(customerID, g.p.RefundTypeID, refund, qty, -price, labels))
+				stats.Refunds++
+			}
+		}
+	}
+	slices.SortStableFunc(events, func(a, b models.EventRecord) int { return a.EventDate.Compare(b.EventDate) })
+	return events, nil
+}
+
+// record construit un événement et son Digest (prix, devise et libellés du client).
+func (g *generator) record(customerID uint64, typeID int, date time.Time, qty int, price float64, labels map[string]string) models.EventRecord {
+	doc := make(map[string]any, len(labels)+1)
+	for k, v := range labels {
+		doc[k] = v
+	}
+	setPath(doc, g.p.Schema.PricePath, json.Number(strconv.FormatFloat(price, 'f', 2, 64)))
+	if g.p.Currency != "" {
+		setPath(doc, g.p.Schema.CurrencyPath, g.p.Currency)
+	}
+	digest, _ := json.Marshal(doc) // clés triées : Digest déterministe
+
+	inserted := date
+	if g.p.InsertSkew > 0 {
+		inserted = date.Add(time.Duration(g.rng.ExpFloat64() * float64(g.p.InsertSkew))).Truncate(time.Second)
+	}
+	return models.EventRecord{
+		CustomerID:  customerID,
+		EventTypeID: typeID,
+		EventDate:   date,
+		Quantity:    qty,
+		Digest:      string(digest),
+		InsertDate:  inserted,
+	}
+}
+
+// setPath écrit v au chemin de clés path ("$.a.b", validé par keyPathRe) de doc.
+func setPath(doc map[string]any, path string, v any) {
+	keys := strings.Split(strings.TrimPrefix(path, "$."), ".")
+	for _, k := range keys[:len(keys)-1] {
+		next, ok := doc[k].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			doc[k] = next
+		}
+		doc = next
+	}
+	doc[keys[len(keys)-1]] = v
+}
+
+// within tire une date uniforme (à la seconde) dans le mois commençant à month.
+func (g *generator) within(month time.Time) time.Time {
+	seconds := int(month.AddDate(0, 1, 0).Sub(month) / time.Second)
+	return month.Add(time.Duration(g.rng.Intn(seconds)) * time.Second)
+}
+
+// price tire un prix unitaire lognormal de moyenne OrderValue, arrondi au centime (au moins 0,01).
+func (g *generator) price() float64 {
+	s := g.p.OrderSigma
+	v := g.p.OrderValue * math.Exp(s*g.rng.NormFloat64()-s*s/2)
+	return math.Max(math.Round(v*100)/100, 0.01)
+}
+
+// quantity tire une quantité : 1 dans 80 % des cas, puis chaque unité supplémentaire avec une probabilité de 20 %, jusqu'à 5.
+func (g *generator) quantity() int {
+	q := 1
+	for q < 5 && g.rng.Float64() < 0.2 {
+		q++
+	}
+	return q
+}
+
+// poisson tire un entier selon une loi de Poisson de moyenne lambda (méthode de Knuth).
+func (g *generator) poisson(lambda float64) int {
+	if lambda <= 0 {
+		return 0
+	}
+	limit, k, prod := math.Exp(-lambda), 0, g.rng.Float64()
+	for prod > limit {
+		k++
+		prod *= g.rng.Float64()
+	}
+	return k
+}
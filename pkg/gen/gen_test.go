@@ -0,0 +1,234 @@
+package gen
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"ltv-monthly/pkg/calculator"
+	"ltv-monthly/pkg/database"
+	"ltv-monthly/pkg/filesource"
+	"ltv-monthly/pkg/models"
+)
+
+func testParams() Params {
+	return Params{
+		Seed:           42,
+		Customers:      300,
+		Start:          time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Months:         6,
+		Growth:         0.05,
+		Seasonality:    0.3,
+		Churn:          0.2,
+		OrdersPerMonth: 0.5,
+		OrderValue:     40,
+		OrderSigma:     0.5,
+		RefundRate:     0.1,
+		RefundTypeID:   7,
+		InsertSkew:     48 * time.Hour,
+		Channels:       []string{"web", "store"},
+		Countries:      []string{"FR", "DE"},
+		Currency:       "EUR",
+	}
+}
+
+func collect(t *testing.T, p Params) ([]models.EventRecord, Stats) {
+	t.Helper()
+	var out []models.EventRecord
+	stats, err := Generate(p, func(e models.EventRecord) error {
+		out = append(out, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return out, stats
+}
+
+func TestGenerate_Deterministic(t *testing.T) {
+	a, sa := collect(t, testParams())
+	b, sb := collect(t, testParams())
+	if !reflect.DeepEqual(a, b) || sa != sb {
+		t.Fatal("same seed produced different events")
+	}
+	p := testParams()
+	p.Seed = 43
+	if c, _ := collect(t, p); reflect.DeepEqual(a, c) {
+		t.Fatal("different seeds produced the same events")
+	}
+}
+
+func TestGenerate_Events(t *testing.T) {
+	p := testParams()
+	events, stats := collect(t, p)
+	until := p.Start.AddDate(0, p.Months+12, 0)
+
+	if stats.Customers != p.Customers || stats.Orders == 0 || stats.Refunds == 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	orders, refunds := 0, 0
+	first := make(map[uint64]time.Time)
+	for i, e := range events {
+		if e.EventID != uint64(i+1) {
+			t.Fatalf("event %d: EventID %d, want sequential IDs", i, e.EventID)
+		}
+		if e.EventDate.Before(p.Start) || !e.EventDate.Before(until) {
+			t.Fatalf("event %d: date %s out of [%s, %s)", e.EventID, e.EventDate, p.Start, until)
+		}
+		if e.InsertDate.Before(e.EventDate) {
+			t.Fatalf("event %d: inserted before its date", e.EventID)
+		}
+		if e.Quantity < 1 || e.Quantity > 5 {
+			t.Fatalf("event %d: quantity %d", e.EventID, e.Quantity)
+		}
+		if !strings.Contains(e.Digest, `"currency":"EUR"`) || !strings.Contains(e.Digest, `"channel":`) {
+			t.Fatalf("event %d: unexpected Digest %s", e.EventID, e.Digest)
+		}
+		switch e.EventTypeID {
+		case 6:
+			orders++
+			if _, ok := first[e.CustomerID]; !ok {
+				first[e.CustomerID] = e.EventDate
+			}
+		case 7:
+			refunds++
+			if !strings.Contains(e.Digest, `"originalUnitPrice":-`) {
+				t.Fatalf("event %d: refund with a positive price: %s", e.EventID, e.Digest)
+			}
+		default:
+			t.Fatalf("event %d: unexpected type %d", e.EventID, e.EventTypeID)
+		}
+	}
+	if orders != stats.Orders || refunds != stats.Refunds || len(first) != p.Customers {
+		t.Fatalf("got %d orders, %d refunds, %d customers; stats %+v", orders, refunds, len(first), stats)
+	}
+	// première commande dans les mois d'acquisition
+	for id, d := range first {
+		if !d.Before(p.Start.AddDate(0, p.Months, 0)) {
+			t.Fatalf("customer %d: first order %s after the acquisition months", id, d)
+		}
+	}
+}
+
+func TestGenerate_SchemaPaths(t *testing.T) {
+	p := testParams()
+	p.Schema = models.Schema{PurchaseEventTypeID: 1, PricePath: "$.amount", CurrencyPath: "$.meta.ccy"}
+	p.RefundRate = 0
+	events, _ := collect(t, p)
+	for _, e := range events {
+		if e.EventTypeID != 1 || !strings.Contains(e.Digest, `"amount":`) || !strings.Contains(e.Digest, `"meta":{"ccy":"EUR"}`) {
+			t.Fatalf("unexpected event %+v", e)
+		}
+	}
+
+	for _, bad := range []func(*Params){
+		func(p *Params) { p.Schema.PricePath = "$.lines[0].amount" },
+		func(p *Params) { p.Channels = []string{"it's"} },
+		func(p *Params) { p.Churn = 1.5 },
+		func(p *Params) { p.Until = p.Start },
+		func(p *Params) { p.RefundTypeID = 6 },
+	} {
+		p := testParams()
+		bad(&p)
+		if _, err := Generate(p, func(models.EventRecord) error { return nil }); err == nil {
+			t.Fatalf("expected error for %+v, got nil", p)
+		}
+	}
+}
+
+func TestWriteSQL(t *testing.T) {
+	var b bytes.Buffer
+	w := NewSQLWriter(&b, models.Schema{}, 2)
+	for id := uint64(1); id <= 3; id++ {
+		day := time.Date(2024, 1, int(id), 0, 0, 0, 0, time.UTC)
+		if err := w.Write(models.EventRecord{EventID: id, CustomerID: 1, EventTypeID: 6, EventDate: day, Quantity: 1, Digest: `{"note":"l'été"}`, InsertDate: day}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	got := b.String()
+	if n := strings.Count(got, "INSERT INTO CustomerEventData"); n != 2 {
+		t.Fatalf("got %d event inserts, want 2:\n%s", n, got)
+	}
+	if n := strings.Count(got, "INSERT INTO CustomerEvent "); n != 2 {
+		t.Fatalf("got %d insert date inserts, want 2:\n%s", n, got)
+	}
+	if !strings.Contains(got, `(3, 1, 6, '2024-01-03 00:00:00', 1, '{"note":"l''été"}')`) {
+		t.Fatalf("unexpected SQL:\n%s", got)
+	}
+}
+
+// TestGenerate_Sources vérifie que le CSV généré et les mêmes événements insérés dans SQLite
+// donnent les mêmes cohortes, avec tous les clients générés.
+func TestGenerate_Sources(t *testing.T) {
+	p := testParams()
+	events, stats := collect(t, p)
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	path := filepath.Join(dir, "events.csv")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewCSVWriter(f)
+	for _, e := range events {
+		if err := w.Write(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	csvSource, err := filesource.Open("file://" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, _, err := database.Open("sqlite://" + filepath.Join(dir, "ltv.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := database.EnsureEventTables(ctx, db, models.Schema{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.InsertEvents(ctx, db, models.Schema{}, events); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := models.Config{
+		StartMonthInclusive: "012024",
+		EndMonthInclusive:   "062024",
+		Observation:         p.Start.AddDate(0, p.Months+12, 0),
+		RefundEventTypeIDs:  []int{7},
+	}
+	want, err := calculator.Run(ctx, csvSource, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clients, orders := 0, 0
+	for _, r := range want {
+		clients += r.CohortClients
+		orders += r.EventsRead
+	}
+	if len(want) != p.Months || clients != stats.Customers || orders != stats.Orders {
+		t.Fatalf("got %d cohorts, %d clients, %d events; stats %+v", len(want), clients, orders, stats)
+	}
+
+	got, err := calculator.Run(ctx, database.NewSQLSource(db), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("SQLite and CSV results differ:\n got %+v\nwant %+v", got, want)
+	}
+}
@@ -0,0 +1,120 @@
+package gen
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"ltv-monthly/pkg/models"
+)
+
+// dateLayout : format des dates écrites (DATETIME UTC, lu par les trois dialectes et par filesource).
+const dateLayout = "2006-01-02 15:04:05"
+
+// csvHeader : colonnes du CSV généré, lisibles par -source=file://events.csv (InsertDate comprise).
+var csvHeader = []string{"EventID", "CustomerID", "EventTypeID", "EventDate", "Quantity", "Digest", "InsertDate"}
+
+// CSVWriter écrit des événements en CSV, une ligne par événement avec sa date d'insertion.
+type CSVWriter struct {
+	w      *csv.Writer
+	header bool
+}
+
+func NewCSVWriter(w io.Writer) *CSVWriter {
+	return &CSVWriter{w: csv.NewWriter(w)}
+}
+
+func (c *CSVWriter) Write(e models.EventRecord) error {
+	if !c.header {
+		c.header = true
+		if err := c.w.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	return c.w.Write([]string{
+		strconv.FormatUint(e.EventID, 10),
+		strconv.FormatUint(e.CustomerID, 10),
+		strconv.Itoa(e.EventTypeID),
+		e.EventDate.UTC().Format(dateLayout),
+		strconv.Itoa(e.Quantity),
+		e.Digest,
+		e.InsertDate.UTC().Format(dateLayout),
+	})
+}
+
+// Flush écrit l'en-tête si aucun événement n'a été écrit, puis vide le tampon.
+func (c *CSVWriter) Flush() error {
+	if !c.header {
+		c.header = true
+		if err := c.w.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// SQLWriter écrit des événements en INSERT multi-lignes de batch lignes, dans la table des
+// événements puis dans celle des dates d'insertion du mapping de schéma. Le SQL (identifiants
+// sans guillemets, littéraux entre apostrophes) est commun à MySQL/MariaDB, PostgreSQL et SQLite.
+type SQLWriter struct {
+	w       *bufio.Writer
+	schema  models.Schema
+	batch   int
+	pending []models.EventRecord
+}
+
+// NewSQLWriter renvoie un SQLWriter vers w ; batch <= 0 vaut 500. Les tables de s doivent exister.
+func NewSQLWriter(w io.Writer, s models.Schema, batch int) *SQLWriter {
+	if batch <= 0 {
+		batch = 500
+	}
+	if s.EventDataTable == "" {
+		s.EventDataTable = "CustomerEventData"
+	}
+	if s.EventTable == "" {
+		s.EventTable = "CustomerEvent"
+	}
+	return &SQLWriter{w: bufio.NewWriter(w), schema: s, batch: batch}
+}
+
+func (s *SQLWriter) Write(e models.EventRecord) error {
+	s.pending = append(s.pending, e)
+	if len(s.pending) < s.batch {
+		return nil
+	}
+	return s.writeBatch()
+}
+
+// Flush écrit les événements en attente et vide le tampon.
+func (s *SQLWriter) Flush() error {
+	if err := s.writeBatch(); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
+
+func (s *SQLWriter) writeBatch() error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+	data := make([]string, len(s.pending))
+	inserts := make([]string, len(s.pending))
+	for i, e := range s.pending {
+		data[i] = fmt.Sprintf("(%d, %d, %d, %s, %d, %s)", e.EventID, e.CustomerID, e.EventTypeID,
+			quote(e.EventDate.UTC().Format(dateLayout)), e.Quantity, quote(e.Digest))
+		inserts[i] = fmt.Sprintf("(%d, %s)", e.EventID, quote(e.InsertDate.UTC().Format(dateLayout)))
+	}
+	s.pending = s.pending[:0]
+	_, err := fmt.Fprintf(s.w, "INSERT INTO %s (EventID, CustomerID, EventTypeID, EventDate, Quantity, Digest) VALUES\n%s;\nINSERT INTO %s (EventID, InsertDate) VALUES\n%s;\n",
+		s.schema.EventDataTable, strings.Join(data, ",\n"), s.schema.EventTable, strings.Join(inserts, ",\n"))
+	return err
+}
+
+// quote renvoie le littéral SQL de v (apostrophes doublées ; Generate n'écrit pas de barre oblique inverse).
+func quote(v string) string {
+	return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+}
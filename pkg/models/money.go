@@ -0,0 +1,273 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+/*
+MONEY → montants en virgule fixe, sans erreur d'arrondi binaire.
+*/
+
+// MoneyDecimals est la précision native des montants, identique au CAST ... AS DECIMAL(18,6) des loaders.
+const MoneyDecimals = 6
+
+// moneyScale = 10^MoneyDecimals.
+const moneyScale = 1_000_000
+
+// Money est un montant exact en millionièmes d'unité monétaire (6 décimales).
+// Les sommes sont exactes ; seules les divisions (moyennes) et l'affichage arrondissent, selon un RoundingMode explicite.
+type Money int64
+
+// RoundingMode est la politique d'arrondi appliquée aux divisions et à l'affichage.
+type RoundingMode string
+
+const (
+	RoundHalfEven RoundingMode = "half_even" // arrondi bancaire : 0.125 → 0.12, 0.135 → 0.14
+	RoundHalfUp   RoundingMode = "half_up"   // arrondi commercial : 0.125 → 0.13 (symétrique pour les négatifs)
+)
+
+// ParseRoundingMode valide le nom de politique d'arrondi ("" = half_even).
+func ParseRoundingMode(s string) (RoundingMode, error) {
+	switch m := RoundingMode(strings.ToLower(strings.TrimSpace(s))); m {
+	case "":
+		return RoundHalfEven, nil
+	case RoundHalfEven, RoundHalfUp:
+		return m, nil
+	}
+	return "", fmt.Errorf("arrondi inconnu %q (attendu: half_even, half_up)", s)
+}
+
+// ParseMoney convertit un décimal ("123.45", "-0.5", "12") en Money.
+// Au-delà de 6 décimales, le montant est arrondi au plus proche (half_even).
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("montant vide")
+	}
+	neg := false
+	switch s[0] {
+	case '-':
+		neg, s = true, s[1:]
+	case '+':
+		s = s[1:]
+	}
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	if intPart == "" && fracPart == "" {
+		return 0, fmt.Errorf("montant invalide %q", s)
+	}
+	for _, r := range intPart + fracPart {
+		if r < '0' || r > '9' {
+			return 0, fmt.Errorf("montant invalide %q", s)
+		}
+	}
+
+	var units int64
+	if intPart != "" {
+		u, err := strconv.ParseInt(intPart, 10, 64)
+		if err != nil || u > math.MaxInt64/moneyScale-1 {
+			return 0, fmt.Errorf("montant hors limites %q", s)
+		}
+		units = u
+	}
+
+	// Fraction sur 6 chiffres ; les chiffres au-delà servent uniquement à l'arrondi.
+	extra := ""
+	if len(fracPart) > MoneyDecimals {
+		fracPart, extra = fracPart[:MoneyDecimals], fracPart[MoneyDecimals:]
+	}
+	fracPart += strings.Repeat("0", MoneyDecimals-len(fracPart))
+	frac, _ := strconv.ParseInt(fracPart, 10, 64)
+
+	m := units*moneyScale + frac
+	if extra != "" {
+		first := extra[0]
+		rest := strings.TrimRight(extra[1:], "0")
+		if first > '5' || (first == '5' && (rest != "" || m%2 == 1)) {
+			m++
+		}
+	}
+	if neg {
+		m = -m
+	}
+	return Money(m), nil
+}
+
+// MoneyFromFloat convertit un flottant en Money, arrondi au millionième le plus proche.
+// À réserver aux sources qui ne fournissent pas de décimal exact.
+func MoneyFromFloat(f float64) Money {
+	return Money(math.Round(f * moneyScale))
+}
+
+// Scan implémente sql.Scanner : DECIMAL lu comme []byte/string, entiers et flottants acceptés ; NULL vaut 0.
+func (m *Money) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+	case []byte:
+		p, err := ParseMoney(string(v))
+		if err != nil {
+			return err
+		}
+		*m = p
+	case string:
+		p, err := ParseMoney(v)
+		if err != nil {
+			return err
+		}
+		*m = p
+	case int64:
+		if v > math.MaxInt64/moneyScale || v < math.MinInt64/moneyScale {
+			return fmt.Errorf("money: montant hors limites %d", v)
+		}
+		*m = Money(v * moneyScale)
+	case float64:
+		if f := v * moneyScale; math.IsNaN(f) || f >= math.MaxInt64 || f < math.MinInt64 {
+			return fmt.Errorf("money: montant hors limites %g", v)
+		}
+		*m = MoneyFromFloat(v)
+	default:
+		return fmt.Errorf("money: type non supporté %T", src)
+	}
+	return nil
+}
+
+// Value implémente driver.Valuer : le montant est transmis en décimal exact ("123.450000").
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// Mul renvoie m × q (ex: prix unitaire × quantité), exact ; erreur si le produit dépasse la capacité de Money.
+func (m Money) Mul(q int) (Money, error) {
+	p := m * Money(q)
+	if q != 0 && (p/Money(q) != m || (q == -1 && m == math.MinInt64)) {
+		return 0, fmt.Errorf("money: dépassement de capacité %s × %d", m, q)
+	}
+	return p, nil
+}
+
+// Abs renvoie la valeur absolue de m.
+func (m Money) Abs() Money {
+	if m < 0 {
+		return -m
+	}
+	return m
+}
+
+// Div renvoie m / n arrondi au millionième selon mode ; n <= 0 donne 0.
+func (m Money) Div(n int, mode RoundingMode) Money {
+	if n <= 0 {
+		return 0
+	}
+	return Money(divRound(int64(m), int64(n), mode))
+}
+
+// MulRat renvoie m × r (taux de change exact) arrondi au millionième selon mode ;
+// erreur si le résultat dépasse la capacité de Money.
+func (m Money) MulRat(r *big.Rat, mode RoundingMode) (Money, error) {
+	num := new(big.Int).Mul(big.NewInt(int64(m)), r.Num())
+	den := r.Denom()
+	q, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Sign() != 0 {
+		twice := new(big.Int).Abs(rem)
+		twice.Lsh(twice, 1)
+		c := twice.Cmp(den)
+		if c > 0 || (c == 0 && (mode == RoundHalfUp || q.Bit(0) == 1)) {
+			q.Add(q, big.NewInt(int64(num.Sign())))
+		}
+	}
+	if !q.IsInt64() {
+		return 0, fmt.Errorf("money: dépassement de capacité %s × %s", m, r.RatString())
+	}
+	return Money(q.Int64()), nil
+}
+
+// Round arrondit m à decimals décimales (0..6) selon mode.
+func (m Money) Round(decimals int, mode RoundingMode) Money {
+	if decimals >= MoneyDecimals || decimals < 0 {
+		return m
+	}
+	f := int64(math.Pow10(MoneyDecimals - decimals))
+	return Money(divRound(int64(m), f, mode) * f)
+}
+
+// String renvoie le montant avec ses 6 décimales ("25.500000").
+func (m Money) String() string {
+	return m.StringFixed(MoneyDecimals)
+}
+
+// StringFixed renvoie le montant avec decimals décimales, tronqué (appeler Round avant pour arrondir).
+func (m Money) StringFixed(decimals int) string {
+	if decimals < 0 {
+		decimals = 0
+	}
+	if decimals > MoneyDecimals {
+		decimals = MoneyDecimals
+	}
+	// négation en uint64 : -math.MinInt64 ne tient pas dans un int64
+	v := uint64(m)
+	sign := ""
+	if m < 0 {
+		sign, v = "-", -v
+	}
+	units, frac := v/moneyScale, v%moneyScale
+	if decimals == 0 {
+		return fmt.Sprintf("%s%d", sign, units)
+	}
+	fs := fmt.Sprintf("%06d", frac)[:decimals]
+	return fmt.Sprintf("%s%d.%s", sign, units, fs)
+}
+
+// Float64 renvoie une approximation flottante (calculs statistiques, jamais pour les sommes).
+func (m Money) Float64() float64 {
+	return float64(m) / moneyScale
+}
+
+// MarshalJSON écrit le montant comme un nombre JSON décimal exact (zéros de fin supprimés).
+func (m Money) MarshalJSON() ([]byte, error) {
+	s := m.String()
+	s = strings.TrimRight(s, "0")
+	s = strings.TrimSuffix(s, ".")
+	return []byte(s), nil
+}
+
+// UnmarshalJSON lit un nombre (ou une chaîne) JSON décimal.
+func (m *Money) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "null" {
+		*m = 0
+		return nil
+	}
+	p, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = p
+	return nil
+}
+
+// divRound renvoie a / b (b > 0) arrondi selon mode.
+func divRound(a, b int64, mode RoundingMode) int64 {
+	q, r := a/b, a%b
+	if r == 0 {
+		return q
+	}
+	neg := r < 0
+	if neg {
+		r = -r
+	}
+	twice := 2 * r
+	up := twice > b || (twice == b && (mode == RoundHalfUp || q%2 != 0))
+	if up {
+		if neg {
+			q--
+		} else {
+			q++
+		}
+	}
+	return q
+}
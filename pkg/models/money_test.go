@@ -0,0 +1,141 @@
+package models
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	cases := map[string]Money{
+		"123.450000":  123_450_000,
+		"0.1":         100_000,
+		"-2.5":        -2_500_000,
+		"7":           7_000_000,
+		".25":         250_000,
+		"1.0000005":   1_000_000, // half_even : 0 pair, reste tel quel
+		"1.0000015":   1_000_002,
+		"1.00000051":  1_000_001,
+		"19.99000000": 19_990_000,
+	}
+	for in, want := range cases {
+		got, err := ParseMoney(in)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", in, err)
+		}
+		if got != want {
+			t.Fatalf("%q: got %d, want %d", in, got, want)
+		}
+	}
+	for _, in := range []string{"", "abc", "1.2.3", "1e5"} {
+		if _, err := ParseMoney(in); err == nil {
+			t.Fatalf("%q: expected error, got nil", in)
+		}
+	}
+}
+
+func TestMoney_SumIsExact(t *testing.T) {
+	// 0.1 + 0.2 en float64 vaut 0.30000000000000004
+	a, _ := ParseMoney("0.1")
+	b, _ := ParseMoney("0.2")
+	if got := (a + b).String(); got != "0.300000" {
+		t.Fatalf("got %s, want 0.300000", got)
+	}
+}
+
+func TestMoney_DivAndRound(t *testing.T) {
+	ten, _ := ParseMoney("10")
+	if got := ten.Div(3, RoundHalfEven).String(); got != "3.333333" {
+		t.Fatalf("got %s, want 3.333333", got)
+	}
+	x, _ := ParseMoney("0.125")
+	if got := x.Round(2, RoundHalfEven).StringFixed(2); got != "0.12" {
+		t.Fatalf("half_even: got %s, want 0.12", got)
+	}
+	if got := x.Round(2, RoundHalfUp).StringFixed(2); got != "0.13" {
+		t.Fatalf("half_up: got %s, want 0.13", got)
+	}
+	if got := (-x).Round(2, RoundHalfUp).StringFixed(2); got != "-0.13" {
+		t.Fatalf("half_up negative: got %s, want -0.13", got)
+	}
+}
+
+func TestMoney_ScanAndJSON(t *testing.T) {
+	var m Money
+	if err := m.Scan([]byte("42.500000")); err != nil || m != 42_500_000 {
+		t.Fatalf("scan []byte: got %d, %v", m, err)
+	}
+	if err := m.Scan(nil); err != nil || m != 0 {
+		t.Fatalf("scan nil: got %d, %v", m, err)
+	}
+	b, err := json.Marshal(Money(42_500_000))
+	if err != nil || string(b) != "42.5" {
+		t.Fatalf("marshal: got %s, %v", b, err)
+	}
+	if err := json.Unmarshal([]byte("19.99"), &m); err != nil || m != 19_990_000 {
+		t.Fatalf("unmarshal: got %d, %v", m, err)
+	}
+}
+
+func TestMoney_Overflow(t *testing.T) {
+	price, _ := ParseMoney("19.99")
+	if got, err := price.Mul(3); err != nil || got != 59_970_000 {
+		t.Fatalf("mul: got %d, %v", got, err)
+	}
+	if got, err := (-price).Mul(2); err != nil || got != -39_980_000 {
+		t.Fatalf("mul negative: got %d, %v", got, err)
+	}
+	for _, tc := range []struct {
+		m Money
+		q int
+	}{
+		{Money(math.MaxInt64 / 2), 3},
+		{Money(math.MinInt64 / 2), 3},
+		{Money(math.MinInt64), -1},
+		{price, math.MaxInt64},
+	} {
+		if got, err := tc.m.Mul(tc.q); err == nil {
+			t.Fatalf("%d×%d: expected overflow error, got %d", tc.m, tc.q, got)
+		}
+	}
+
+	if got, err := Money(math.MaxInt64/2).MulRat(big.NewRat(3, 1), RoundHalfEven); err == nil {
+		t.Fatalf("mulrat: expected overflow error, got %d", got)
+	}
+	if got := Money(math.MinInt64).String(); got != "-9223372036854.775808" {
+		t.Fatalf("string MinInt64: got %s", got)
+	}
+
+	var m Money
+	if err := m.Scan(int64(42)); err != nil || m != 42_000_000 {
+		t.Fatalf("scan int64: got %d, %v", m, err)
+	}
+	for _, src := range []any{int64(math.MaxInt64 / 1000), int64(math.MinInt64 / 1000), 1e13, -1e13, math.NaN()} {
+		if err := m.Scan(src); err == nil {
+			t.Fatalf("scan %v: expected overflow error, got %d", src, m)
+		}
+	}
+}
+
+func TestMoney_MulRat(t *testing.T) {
+	rate, _ := new(big.Rat).SetString("1.17")
+	if got, err := MoneyFromFloat(10).MulRat(rate, RoundHalfEven); err != nil || got != 11_700_000 {
+		t.Fatalf("got %d, %v, want 11700000", got, err)
+	}
+	half := big.NewRat(1, 2)
+	for _, tc := range []struct {
+		in   Money
+		mode RoundingMode
+		want Money
+	}{
+		{5, RoundHalfEven, 2}, // 2.5 → 2
+		{5, RoundHalfUp, 3},
+		{7, RoundHalfEven, 4}, // 3.5 → 4
+		{-5, RoundHalfUp, -3},
+	} {
+		if got, _ := tc.in.MulRat(half, tc.mode); got != tc.want {
+			t.Fatalf("%d×1/2 (%s): got %d, want %d", tc.in, tc.mode, got, tc.want)
+		}
+	}
+}
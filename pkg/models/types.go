@@ -10,16 +10,31 @@ LOAD → types simples pour charger les données brutes de la base de données.
 
 // RawEventData représente un événement de commande brut tel qu'il est lu depuis la base de données.
 type RawEventData struct {
-	EventID    uint64
-	CustomerID uint64
-	EventDate  time.Time
-	Quantity   int
-	UnitPrice  float64
+	EventID     uint64
+	CustomerID  uint64
+	EventTypeID int // 6 = achat ; les types de Config.RefundEventTypeIDs sont soustraits du revenu.
+	EventDate   time.Time
+	Quantity    int
+	UnitPrice   Money
+	Segments    []string // Valeurs des chemins JSON de Config.SegmentBy extraites du Digest (vide si non demandé).
+	Currency    string   // Devise lue dans le Digest (Schema.CurrencyPath), renseignée uniquement si Config.Currency est défini.
 }
 
 // RawEventsInsertDate représente un événement de commande avec sa date d'insertion tel qu'il est lu depuis la base de données.
 type RawEventsInsertDate struct {
 	EventID    uint64
+	InsertDate time.Time
+}
+
+// EventRecord est une ligne complète de la table des événements (Digest JSON brut) avec sa date
+// d'insertion dans la table CustomerEvent, telle qu'écrite par le générateur de données synthétiques.
+type EventRecord struct {
+	EventID     uint64
+	CustomerID  uint64
+	EventTypeID int
+	EventDate   time.Time
+	Quantity    int
+	Digest      string
 	InsertDate  time.Time
 }
 
@@ -33,11 +48,122 @@ type CohortCustomer struct {
 COMPUTE → structure de résultat exportée par mois de cohorte
 */
 // CohortResult contient les métriques calculées pour une cohorte mensuelle.
+// Les tags JSON sont les noms de champs stables utilisés par les formats de sortie.
 type CohortResult struct {
-	MonthYear     string  // Mois de la cohorte (format "MM/YYYY").
-	LTVAvg        float64 // Lifetime Value moyenne des clients de la cohorte.
-	CohortClients int     // Nombre total de clients dans la cohorte.
-	EventsRead    int     // Nombre total d'événements de commande pour cette cohorte.
+	MonthYear     string            `json:"month"`              // Période de la cohorte ("MM/YYYY" en granularité mensuelle, voir Config.Granularity).
+	PeriodStart   time.Time         `json:"period_start"`       // Début (UTC) de la période de la cohorte.
+	Segments      map[string]string `json:"segments,omitempty"` // Valeur de chaque chemin de Config.SegmentBy pour cette ligne.
+	LTVAvg        Money             `json:"ltv_avg"`            // Lifetime Value brute moyenne des clients de la cohorte.
+	CohortClients int               `json:"cohort_clients"`     // Nombre total de clients dans la cohorte.
+	EventsRead    int               `json:"events"`             // Nombre total d'événements de commande pour cette cohorte.
+	RefundsAvg    Money             `json:"refunds_avg"`        // Remboursements/annulations moyens par client (montant positif).
+	NetLTVAvg     Money             `json:"net_ltv_avg"`        // LTVAvg - RefundsAvg.
+
+	UnconvertedEvents int `json:"unconverted_events,omitempty"` // Événements exclus des montants : devise absente, inconnue ou sans taux (Config.Currency).
+
+	Predicted []PredictedLTV `json:"predicted,omitempty"` // LTV prédites, une par horizon de Config.PredictHorizons.
+	Retention *Retention     `json:"retention,omitempty"` // Rétention et réachat, si Config.Retention.
+
+	Distribution *Distribution `json:"distribution,omitempty"` // Distribution de la LTV par client, si Config.Distribution.
+	LTVCI        *Interval     `json:"ltv_ci,omitempty"`       // Intervalle de confiance bootstrap de LTVAvg, si Config.Bootstrap.
+}
+
+// Interval est un intervalle de confiance au niveau Level (ex: 0.95).
+type Interval struct {
+	Low   Money   `json:"low"`
+	High  Money   `json:"high"`
+	Level float64 `json:"level"`
+}
+
+// Distribution décrit la répartition du revenu brut par client d'une cohorte (clients sans revenu inclus).
+type Distribution struct {
+	Median     Money   `json:"median"`
+	P25        Money   `json:"p25"`
+	P75        Money   `json:"p75"`
+	P90        Money   `json:"p90"`
+	P99        Money   `json:"p99"`
+	StdDev     Money   `json:"stddev"`      // Écart-type (population).
+	Top1Share  float64 `json:"top1_share"`  // Part du revenu des 1 % meilleurs clients (au moins un client).
+	Top10Share float64 `json:"top10_share"` // Part du revenu des 10 % meilleurs clients (au moins un client).
+
+	AdjustedAvg Money `json:"adjusted_avg,omitempty"` // Moyenne après traitement des valeurs extrêmes (Config.Outliers).
+}
+
+// Retention contient les métriques de rétention et de réachat d'une cohorte.
+// Une commande est un jour d'achat valorisé distinct d'un client.
+type Retention struct {
+	ActiveCustomers    []int     `json:"active_customers"`     // ActiveCustomers[k] = clients ayant acheté à l'âge k (M0, M1, ...), jusqu'à Observation.
+	RetentionRate      []float64 `json:"retention_rate"`       // ActiveCustomers[k] / CohortClients.
+	RepeatPurchaseRate float64   `json:"repeat_purchase_rate"` // Part des clients ayant passé au moins 2 commandes.
+	AvgOrders          float64   `json:"avg_orders"`           // Commandes moyennes par client.
+	AvgOrderValue      Money     `json:"avg_order_value"`      // Revenu brut / commandes.
+}
+
+// PredictedLTV est la LTV brute moyenne attendue Months mois après Observation :
+// revenu historique + revenu futur prédit (BG/NBD + Gamma-Gamma, non actualisé).
+type PredictedLTV struct {
+	Months int   `json:"months"`
+	LTVAvg Money `json:"ltv_avg"`
+}
+
+// CustomerRange est une plage de CustomerID [From, To] (bornes incluses) chargée par une seule requête.
+type CustomerRange struct {
+	From uint64
+	To   uint64
+}
+
+// CohortAggregate contient les sommes d'une période de cohorte calculées par la source elle-même (mode pushdown).
+type CohortAggregate struct {
+	PeriodStart time.Time // Début (UTC) de la période de cohorte.
+	Clients     int       // Clients dont la première commande est dans la période.
+	Revenue     Money     // Revenu brut cumulé de ces clients jusqu'à Observation.
+	Events      int       // Événements d'achat valorisés.
+	Refunds     Money     // Remboursements cumulés (montant positif).
+}
+
+// CohortTriangle contient la LTV cumulée d'une cohorte mensuelle par âge (mois depuis l'acquisition).
+type CohortTriangle struct {
+	MonthYear     string  `json:"month"`          // Mois de la cohorte (format "MM/YYYY").
+	CohortClients int     `json:"cohort_clients"` // Nombre total de clients dans la cohorte.
+	CumulativeLTV []Money `json:"cumulative_ltv"` // CumulativeLTV[k] = revenu cumulé par client de M0 à Mk, jusqu'à Observation.
+}
+
+// ModeValues contient les valeurs d'une cohorte calculées par un mode, pour la réconciliation.
+type ModeValues struct {
+	Mode          string `json:"mode"`
+	Missing       bool   `json:"missing,omitempty"` // Cohorte absente des résultats de ce mode.
+	LTVAvg        Money  `json:"ltv_avg"`
+	CohortClients int    `json:"cohort_clients"`
+	EventsRead    int    `json:"events"`
+}
+
+// CohortReconciliation compare une cohorte (période × segment) entre plusieurs modes de calcul.
+type CohortReconciliation struct {
+	MonthYear   string            `json:"month"`
+	PeriodStart time.Time         `json:"period_start"`
+	Segments    map[string]string `json:"segments,omitempty"`
+	Values      []ModeValues      `json:"values"`   // Un élément par mode comparé, le premier sert de référence.
+	Diverges    bool              `json:"diverges"` // Au moins un mode s'écarte de la référence au-delà des tolérances.
+}
+
+// CustomerState contient les agrégats persistés d'un client à la dernière observation (calcul incrémental).
+type CustomerState struct {
+	CustomerID   uint64
+	First        time.Time // Date de la première commande (zéro : client sans achat, remboursements seuls).
+	FirstEventID uint64    // EventID de la première commande, départage les commandes simultanées.
+	Revenue      Money     // Revenu brut cumulé.
+	Events       int       // Événements d'achat valorisés.
+	Refunds      Money     // Remboursements cumulés (montant positif).
+	Segments     []string  // Valeurs de Config.SegmentBy lues sur la première commande.
+}
+
+// State est l'état persisté du calcul incrémental : les agrégats de tous les clients
+// pour les événements antérieurs à Observation.
+type State struct {
+	Observation time.Time       // Borne exclusive des événements déjà intégrés.
+	Fingerprint string          // Empreinte des paramètres qui influencent les agrégats (schéma, remboursements, segments).
+	EventsRead  int             // Événements intégrés, comparés à la source par le contrôle de cohérence.
+	Customers   []CustomerState // Un élément par client.
 }
 
 /*
@@ -45,8 +171,59 @@ CONFIG → paramètres globaux
 */
 // Config contient les paramètres de configuration passés à la fonction de calcul.
 type Config struct {
-	StartMonthInclusive string    // "MMYYYY"
-	EndMonthInclusive   string    // "MMYYYY"
-	Observation         time.Time // borne haute (ex: 1er jour du mois courant) – en UTC
-	Verbose             bool      // Flag pour activer les logs détaillés.
+	StartMonthInclusive string       // "MMYYYY" (mois entier) ou "YYYY-MM-DD"
+	EndMonthInclusive   string       // "MMYYYY" (mois entier) ou "YYYY-MM-DD"
+	Observation         time.Time    // borne haute exclusive des événements (ex: 1er jour du mois courant) – en UTC ; zéro = mois courant
+	Verbose             bool         // Flag pour activer les logs détaillés.
+	ChunkSize           int          // Nombre d'IDs par requête IN (...) ; 0 = valeur par défaut du loader.
+	LoadWorkers         int          // Nombre de lots chargés en parallèle ; <= 1 = séquentiel.
+	Partitions          int          // Plages de CustomerID des chargements complets, lues sur LoadWorkers connexions ; <= 1 = une seule requête.
+	RefundEventTypeIDs  []int        // Types d'événements (remboursement, annulation, retour) soustraits du revenu brut.
+	Schema              Schema       // Mapping vers le schéma de la base ; champs vides = valeurs par défaut.
+	Granularity         string       // Taille des cohortes : day, week, month (défaut), quarter, year.
+	SegmentBy           []string     // Chemins JSON du Digest (première commande) segmentant chaque cohorte, ex: "$.channel".
+	Rounding            RoundingMode // Arrondi des moyennes au millionième ; "" = half_even.
+
+	// PredictHorizons : horizons (mois après Observation) de LTV prédite, ex: 6, 12, 24 ; vide = pas de prédiction.
+	PredictHorizons []int
+	// Retention ajoute les métriques de rétention et de réachat (Retention) à chaque cohorte.
+	Retention bool
+	// Distribution ajoute médiane, percentiles, écart-type et concentration du revenu (Distribution).
+	Distribution bool
+	// Bootstrap : intervalle de confiance de LTVAvg par rééchantillonnage des clients ; Iterations = 0 = désactivé.
+	Bootstrap Bootstrap
+	// Outliers : traitement des valeurs extrêmes pour Distribution.AdjustedAvg ; zéro = aucun.
+	Outliers OutlierPolicy
+
+	// Currency convertit chaque événement dans la devise de reporting ; nil = montants additionnés tels quels.
+	Currency CurrencyConverter
+}
+
+// CurrencyConverter convertit un montant dans la devise de reporting au taux en vigueur à une date.
+// ok = false si la devise est inconnue ou sans taux à cette date : l'événement est alors compté à part.
+type CurrencyConverter interface {
+	Convert(amount Money, currency string, at time.Time, mode RoundingMode) (converted Money, ok bool, err error)
+}
+
+// Bootstrap paramètre les intervalles de confiance bootstrap (méthode des percentiles).
+type Bootstrap struct {
+	Iterations int     // Nombre de rééchantillonnages, ex: 1000.
+	Confidence float64 // Niveau de confiance dans ]0, 1[ ; 0 = 0.95.
+	Seed       int64   // Graine : même graine, mêmes intervalles.
+}
+
+// OutlierPolicy décrit le traitement des clients au-delà d'un percentile de revenu avant moyenne.
+type OutlierPolicy struct {
+	Method     string  // "" (aucun), "trim" (exclus) ou "winsorize" (ramenés au seuil).
+	Percentile float64 // Seuil haut dans ]0, 1[, ex: 0.99.
+}
+
+// Schema décrit le mapping vers le schéma de la base du tenant.
+// Les noms de colonnes (EventID, CustomerID, EventTypeID, EventDate, Quantity, Digest, InsertDate) sont fixes.
+type Schema struct {
+	EventDataTable      string // Table des événements (défaut "CustomerEventData").
+	EventTable          string // Table des dates d'insertion (défaut "CustomerEvent").
+	PurchaseEventTypeID int    // EventTypeID des achats (défaut 6).
+	PricePath           string // Chemin JSON du prix unitaire dans Digest (défaut "$.price.originalUnitPrice").
+	CurrencyPath        string // Chemin JSON de la devise dans Digest (défaut "$.price.currency"), lu si Config.Currency est défini.
 }
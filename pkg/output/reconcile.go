@@ -0,0 +1,123 @@
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"ltv-monthly/pkg/models"
+)
+
+// WriteReconciliation sérialise la comparaison des modes : une ligne par cohorte, puis pour chaque mode
+// ltv_avg, cohort_clients et events, l'écart de LTV de chaque mode à la référence (premier mode) et le statut.
+// Une cohorte absente d'un mode laisse ses valeurs vides (csv) ou "-" (table).
+func WriteReconciliation(w io.Writer, f Format, rows []models.CohortReconciliation, opts Options) error {
+	rows = roundReconciliation(rows, opts)
+	var modes []string
+	if len(rows) > 0 {
+		for _, v := range rows[0].Values {
+			modes = append(modes, v.Mode)
+		}
+	}
+
+	switch f {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(reconciliationColumns(modes, opts)); err != nil {
+			return err
+		}
+		for _, r := range rows {
+			if err := cw.Write(reconciliationValues(r, opts, "")); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	case FormatJSON:
+		if rows == nil {
+			rows = []models.CohortReconciliation{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+	case FormatJSONL:
+		enc := json.NewEncoder(w)
+		for _, r := range rows {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatTable, "":
+		if _, err := fmt.Fprintln(w, " "+strings.Join(reconciliationColumns(modes, opts), " ; ")); err != nil {
+			return err
+		}
+		for _, r := range rows {
+			if _, err := fmt.Fprintln(w, strings.Join(reconciliationValues(r, opts, "-"), " ; ")); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("format inconnu %q", f)
+}
+
+// reconciliationColumns renvoie les en-têtes : month, segments, valeurs par mode, écarts à la référence, status.
+func reconciliationColumns(modes []string, opts Options) []string {
+	header := append([]string{"month"}, opts.SegmentBy...)
+	for _, m := range modes {
+		header = append(header, "ltv_avg_"+m, "cohort_clients_"+m, "events_"+m)
+	}
+	for _, m := range modes[min(1, len(modes)):] {
+		header = append(header, "ltv_delta_"+m)
+	}
+	return append(header, "status")
+}
+
+// reconciliationValues renvoie les valeurs de r alignées sur reconciliationColumns ; missing remplace les valeurs absentes.
+func reconciliationValues(r models.CohortReconciliation, opts Options, missing string) []string {
+	rec := []string{r.MonthYear}
+	for _, p := range opts.SegmentBy {
+		rec = append(rec, r.Segments[p])
+	}
+	for _, v := range r.Values {
+		if v.Missing {
+			rec = append(rec, missing, missing, missing)
+			continue
+		}
+		rec = append(rec, opts.money(v.LTVAvg), strconv.Itoa(v.CohortClients), strconv.Itoa(v.EventsRead))
+	}
+	if len(r.Values) > 0 {
+		ref := r.Values[0]
+		for _, v := range r.Values[1:] {
+			if v.Missing || ref.Missing {
+				rec = append(rec, missing)
+				continue
+			}
+			rec = append(rec, opts.money(v.LTVAvg-ref.LTVAvg))
+		}
+	}
+	status := "ok"
+	if r.Diverges {
+		status = "DIVERGES"
+	}
+	return append(rec, status)
+}
+
+// roundReconciliation renvoie une copie de rows dont les LTV sont arrondies selon opts (sortie JSON).
+func roundReconciliation(rows []models.CohortReconciliation, opts Options) []models.CohortReconciliation {
+	out := make([]models.CohortReconciliation, len(rows))
+	for i, r := range rows {
+		values := make([]models.ModeValues, len(r.Values))
+		for j, v := range r.Values {
+			v.LTVAvg = opts.round(v.LTVAvg)
+			values[j] = v
+		}
+		r.Values = values
+		out[i] = r
+	}
+	return out
+}
@@ -0,0 +1,40 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+
+	"ltv-monthly/pkg/models"
+)
+
+func TestWriteReconciliation(t *testing.T) {
+	rows := []models.CohortReconciliation{
+		{MonthYear: "01/2025", Values: []models.ModeValues{
+			{Mode: "normal", LTVAvg: models.MoneyFromFloat(25), CohortClients: 2, EventsRead: 3},
+			{Mode: "withInsertDate", LTVAvg: models.MoneyFromFloat(20), CohortClients: 1, EventsRead: 2},
+		}, Diverges: true},
+		{MonthYear: "02/2025", Values: []models.ModeValues{
+			{Mode: "normal", LTVAvg: models.MoneyFromFloat(7), CohortClients: 1, EventsRead: 1},
+			{Mode: "withInsertDate", Missing: true},
+		}, Diverges: true},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteReconciliation(&buf, FormatCSV, rows, Options{Decimals: 2}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "month,ltv_avg_normal,cohort_clients_normal,events_normal,ltv_avg_withInsertDate,cohort_clients_withInsertDate,events_withInsertDate,ltv_delta_withInsertDate,status\n" +
+		"01/2025,25.00,2,3,20.00,1,2,-5.00,DIVERGES\n" +
+		"02/2025,7.00,1,1,,,,,DIVERGES\n"
+	if buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := WriteReconciliation(&buf, FormatTable, rows[1:], Options{Decimals: 2}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "02/2025 ; 7.00 ; 1 ; 1 ; - ; - ; - ; - ; DIVERGES\n"; !bytes.HasSuffix(buf.Bytes(), []byte(want)) {
+		t.Fatalf("unexpected table: %q", buf.String())
+	}
+}
@@ -0,0 +1,457 @@
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"ltv-monthly/pkg/models"
+)
+
+// Format identifie un format de sortie des résultats.
+type Format string
+
+const (
+	FormatTable Format = "table" // tableau "month ; ltv_avg_gross_on_period" historique, lisible à l'écran
+	FormatCSV   Format = "csv"   // CSV avec en-tête, séparateur ","
+	FormatJSON  Format = "json"  // tableau JSON unique
+	FormatJSONL Format = "jsonl" // un objet JSON par ligne
+)
+
+// Options contient les options d'affichage communes aux formats.
+type Options struct {
+	ShowCalculationDetails bool                // table uniquement : ajoute cohort_clients et events (toujours présents en csv/json).
+	ShowNet                bool                // table uniquement : ajoute refunds_avg et net_ltv_avg (toujours présents en csv/json).
+	SegmentBy              []string            // chemins JSON de segmentation : une colonne par chemin après "month" (table/csv).
+	Decimals               int                 // décimales des montants (1..6) ; 0 = précision native (6).
+	Rounding               models.RoundingMode // arrondi des montants à Decimals ; "" = half_even.
+	ShowUnconverted        bool                // table/csv : ajoute unconverted_events en dernière colonne (conversion de devises active).
+	PredictHorizons        []int               // table/csv : une colonne predicted_ltv_<n>m par horizon, avant unconverted_events.
+	ShowRetention          bool                // table/csv : ajoute réachat, commandes, panier moyen et retention_m0.. après la distribution.
+	ShowDistribution       bool                // table/csv : ajoute médiane, percentiles, écart-type et parts top 1 %/10 % après les prédictions.
+	ShowAdjusted           bool                // table/csv : avec ShowDistribution, ajoute adjusted_avg (traitement des valeurs extrêmes).
+	ShowCI                 bool                // table/csv : ajoute ltv_ci_low et ltv_ci_high (bootstrap) avant les prédictions.
+}
+
+// decimals renvoie le nombre de décimales effectif des montants.
+func (o Options) decimals() int {
+	if o.Decimals <= 0 || o.Decimals > models.MoneyDecimals {
+		return models.MoneyDecimals
+	}
+	return o.Decimals
+}
+
+// round applique la politique d'arrondi de sortie à un montant.
+func (o Options) round(m models.Money) models.Money {
+	return m.Round(o.decimals(), o.Rounding)
+}
+
+// money formate un montant arrondi avec un nombre fixe de décimales.
+func (o Options) money(m models.Money) string {
+	return o.round(m).StringFixed(o.decimals())
+}
+
+// ParseFormat valide le nom de format saisi par l'utilisateur.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimSpace(s))); f {
+	case FormatTable, FormatCSV, FormatJSON, FormatJSONL:
+		return f, nil
+	}
+	return "", fmt.Errorf("format inconnu %q (attendu: table, csv, json, jsonl)", s)
+}
+
+// resultColumns : noms de colonnes stables, identiques aux clés JSON de models.CohortResult.
+var resultColumns = []string{"month", "ltv_avg", "cohort_clients", "events", "refunds_avg", "net_ltv_avg", "period_start"}
+
+// WriteResults sérialise les résultats de cohortes dans le format demandé.
+// Les montants sont arrondis selon opts (Decimals, Rounding) dans tous les formats.
+func WriteResults(w io.Writer, f Format, results []models.CohortResult, opts Options) error {
+	results = roundResults(results, opts)
+	ages := 0
+	if opts.ShowRetention {
+		ages = maxRetentionAges(results)
+	}
+	switch f {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		header := append([]string{resultColumns[0]}, opts.SegmentBy...)
+		header = append(header, resultColumns[1:]...)
+		header = append(header, ciColumns(opts)...)
+		header = append(header, predictedColumns(opts.PredictHorizons)...)
+		header = append(header, distributionColumns(opts)...)
+		if opts.ShowRetention {
+			header = append(header, retentionColumns(ages)...)
+		}
+		if opts.ShowUnconverted {
+			header = append(header, "unconverted_events")
+		}
+		if err := cw.Write(header); err != nil {
+			return err
+		}
+		for _, r := range results {
+			rec := []string{r.MonthYear}
+			rec = append(rec, segmentValues(r, opts.SegmentBy)...)
+			rec = append(rec, opts.money(r.LTVAvg), strconv.Itoa(r.CohortClients), strconv.Itoa(r.EventsRead),
+				opts.money(r.RefundsAvg), opts.money(r.NetLTVAvg), formatDate(r.PeriodStart))
+			rec = append(rec, ciValues(r, opts)...)
+			rec = append(rec, predictedValues(r, opts)...)
+			rec = append(rec, distributionValues(r, opts)...)
+			if opts.ShowRetention {
+				rec = append(rec, retentionValues(r, ages, opts)...)
+			}
+			if opts.ShowUnconverted {
+				rec = append(rec, strconv.Itoa(r.UnconvertedEvents))
+			}
+			if err := cw.Write(rec); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	case FormatJSON:
+		if results == nil {
+			results = []models.CohortResult{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	case FormatJSONL:
+		enc := json.NewEncoder(w)
+		for _, r := range results {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatTable, "":
+		header := " month"
+		for _, p := range opts.SegmentBy {
+			header += " ; " + p
+		}
+		header += " ; ltv_avg_gross_on_period"
+		if opts.ShowNet {
+			header += " ; refunds_avg ; ltv_avg_net_on_period"
+		}
+		if opts.ShowCalculationDetails {
+			header += " ; cohort_clients ; events"
+		}
+		for _, c := range slices.Concat(ciColumns(opts), predictedColumns(opts.PredictHorizons), distributionColumns(opts)) {
+			header += " ; " + c
+		}
+		if opts.ShowRetention {
+			for _, c := range retentionColumns(ages) {
+				header += " ; " + c
+			}
+		}
+		if opts.ShowUnconverted {
+			header += " ; unconverted_events"
+		}
+		if _, err := fmt.Fprintln(w, header); err != nil {
+			return err
+		}
+		for _, r := range results {
+			line := r.MonthYear
+			for _, v := range segmentValues(r, opts.SegmentBy) {
+				line += " ; " + v
+			}
+			line += " ; " + opts.money(r.LTVAvg)
+			if opts.ShowNet {
+				line += " ; " + opts.money(r.RefundsAvg) + " ; " + opts.money(r.NetLTVAvg)
+			}
+			if opts.ShowCalculationDetails {
+				line += fmt.Sprintf(" ; %d ; %d", r.CohortClients, r.EventsRead)
+			}
+			for _, v := range slices.Concat(ciValues(r, opts), predictedValues(r, opts), distributionValues(r, opts)) {
+				line += " ; " + v
+			}
+			if opts.ShowRetention {
+				for _, v := range retentionValues(r, ages, opts) {
+					line += " ; " + v
+				}
+			}
+			if opts.ShowUnconverted {
+				line += fmt.Sprintf(" ; %d", r.UnconvertedEvents)
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("format inconnu %q", f)
+}
+
+// WriteTriangle sérialise le triangle de cohortes : une ligne par cohorte, une colonne par âge (M0, M1, ...).
+func WriteTriangle(w io.Writer, f Format, rows []models.CohortTriangle, opts Options) error {
+	rows = roundTriangle(rows, opts)
+	maxAges := 0
+	for _, r := range rows {
+		if len(r.CumulativeLTV) > maxAges {
+			maxAges = len(r.CumulativeLTV)
+		}
+	}
+
+	switch f {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		header := []string{"month", "cohort_clients"}
+		for k := 0; k < maxAges; k++ {
+			header = append(header, fmt.Sprintf("m%d", k))
+		}
+		if err := cw.Write(header); err != nil {
+			return err
+		}
+		for _, r := range rows {
+			rec := []string{r.MonthYear, strconv.Itoa(r.CohortClients)}
+			for k := 0; k < maxAges; k++ {
+				v := ""
+				if k < len(r.CumulativeLTV) {
+					v = opts.money(r.CumulativeLTV[k])
+				}
+				rec = append(rec, v)
+			}
+			if err := cw.Write(rec); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	case FormatJSON:
+		if rows == nil {
+			rows = []models.CohortTriangle{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+	case FormatJSONL:
+		enc := json.NewEncoder(w)
+		for _, r := range rows {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatTable, "":
+		header := " month"
+		if opts.ShowCalculationDetails {
+			header += " ; cohort_clients"
+		}
+		for k := 0; k < maxAges; k++ {
+			header += fmt.Sprintf(" ; M%d", k)
+		}
+		if _, err := fmt.Fprintln(w, header); err != nil {
+			return err
+		}
+		for _, r := range rows {
+			line := r.MonthYear
+			if opts.ShowCalculationDetails {
+				line += fmt.Sprintf(" ; %d", r.CohortClients)
+			}
+			for k := 0; k < maxAges; k++ {
+				if k < len(r.CumulativeLTV) {
+					line += " ; " + opts.money(r.CumulativeLTV[k])
+				} else {
+					line += " ;"
+				}
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("format inconnu %q", f)
+}
+
+// segmentValues renvoie les valeurs de segment de r dans l'ordre des chemins demandés.
+func segmentValues(r models.CohortResult, paths []string) []string {
+	out := make([]string, len(paths))
+	for i, p := range paths {
+		out[i] = r.Segments[p]
+	}
+	return out
+}
+
+// formatDate écrit le début de période en "YYYY-MM-DD" (vide si inconnu).
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format("2006-01-02")
+}
+
+// ciColumns renvoie les en-têtes de l'intervalle de confiance ; aucun sans ShowCI.
+func ciColumns(opts Options) []string {
+	if !opts.ShowCI {
+		return nil
+	}
+	return []string{"ltv_ci_low", "ltv_ci_high"}
+}
+
+// ciValues renvoie les bornes de l'intervalle de confiance de r, alignées sur ciColumns.
+func ciValues(r models.CohortResult, opts Options) []string {
+	if !opts.ShowCI {
+		return nil
+	}
+	if r.LTVCI == nil {
+		return []string{"", ""}
+	}
+	return []string{opts.money(r.LTVCI.Low), opts.money(r.LTVCI.High)}
+}
+
+// predictedColumns renvoie les en-têtes des LTV prédites : predicted_ltv_6m, predicted_ltv_12m, ...
+func predictedColumns(horizons []int) []string {
+	out := make([]string, len(horizons))
+	for i, h := range horizons {
+		out[i] = fmt.Sprintf("predicted_ltv_%dm", h)
+	}
+	return out
+}
+
+// predictedValues renvoie la LTV prédite de r pour chaque horizon de opts ("" si absente).
+func predictedValues(r models.CohortResult, opts Options) []string {
+	out := make([]string, len(opts.PredictHorizons))
+	for i, h := range opts.PredictHorizons {
+		for _, p := range r.Predicted {
+			if p.Months == h {
+				out[i] = opts.money(p.LTVAvg)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// distributionColumns renvoie les en-têtes de distribution ; aucun sans ShowDistribution.
+func distributionColumns(opts Options) []string {
+	if !opts.ShowDistribution {
+		return nil
+	}
+	cols := []string{"median", "p25", "p75", "p90", "p99", "stddev", "top1_share", "top10_share"}
+	if opts.ShowAdjusted {
+		cols = append(cols, "adjusted_avg")
+	}
+	return cols
+}
+
+// distributionValues renvoie les valeurs de distribution de r, alignées sur distributionColumns.
+func distributionValues(r models.CohortResult, opts Options) []string {
+	cols := len(distributionColumns(opts))
+	if cols == 0 {
+		return nil
+	}
+	out := make([]string, cols)
+	d := r.Distribution
+	if d == nil {
+		return out
+	}
+	copy(out, []string{
+		opts.money(d.Median), opts.money(d.P25), opts.money(d.P75), opts.money(d.P90), opts.money(d.P99),
+		opts.money(d.StdDev), formatRate(d.Top1Share), formatRate(d.Top10Share),
+	})
+	if opts.ShowAdjusted {
+		out[8] = opts.money(d.AdjustedAvg)
+	}
+	return out
+}
+
+// maxRetentionAges renvoie le plus grand nombre d'âges de rétention parmi les résultats.
+func maxRetentionAges(results []models.CohortResult) int {
+	n := 0
+	for _, r := range results {
+		if r.Retention != nil {
+			n = max(n, len(r.Retention.RetentionRate))
+		}
+	}
+	return n
+}
+
+// retentionColumns renvoie les en-têtes de rétention pour ages âges.
+func retentionColumns(ages int) []string {
+	out := []string{"repeat_purchase_rate", "avg_orders", "avg_order_value"}
+	for k := 0; k < ages; k++ {
+		out = append(out, fmt.Sprintf("retention_m%d", k))
+	}
+	return out
+}
+
+// retentionValues renvoie les valeurs de rétention de r ; les âges non atteints restent vides.
+func retentionValues(r models.CohortResult, ages int, opts Options) []string {
+	out := make([]string, 3+ages)
+	if r.Retention == nil {
+		return out
+	}
+	out[0] = formatRate(r.Retention.RepeatPurchaseRate)
+	out[1] = formatRate(r.Retention.AvgOrders)
+	out[2] = opts.money(r.Retention.AvgOrderValue)
+	for k, v := range r.Retention.RetentionRate {
+		out[3+k] = formatRate(v)
+	}
+	return out
+}
+
+// formatRate écrit un taux ou une moyenne avec 4 décimales.
+func formatRate(v float64) string {
+	return strconv.FormatFloat(v, 'f', 4, 64)
+}
+
+// roundResults renvoie une copie des résultats aux montants arrondis selon opts.
+func roundResults(results []models.CohortResult, opts Options) []models.CohortResult {
+	if results == nil {
+		return nil
+	}
+	out := make([]models.CohortResult, len(results))
+	for i, r := range results {
+		r.LTVAvg = opts.round(r.LTVAvg)
+		r.RefundsAvg = opts.round(r.RefundsAvg)
+		r.NetLTVAvg = opts.round(r.NetLTVAvg)
+		if r.Predicted != nil {
+			pred := make([]models.PredictedLTV, len(r.Predicted))
+			for k, p := range r.Predicted {
+				pred[k] = models.PredictedLTV{Months: p.Months, LTVAvg: opts.round(p.LTVAvg)}
+			}
+			r.Predicted = pred
+		}
+		if r.LTVCI != nil {
+			ci := *r.LTVCI
+			ci.Low, ci.High = opts.round(ci.Low), opts.round(ci.High)
+			r.LTVCI = &ci
+		}
+		if r.Distribution != nil {
+			d := *r.Distribution
+			for _, m := range []*models.Money{&d.Median, &d.P25, &d.P75, &d.P90, &d.P99, &d.StdDev, &d.AdjustedAvg} {
+				*m = opts.round(*m)
+			}
+			r.Distribution = &d
+		}
+		if r.Retention != nil {
+			ret := *r.Retention
+			ret.AvgOrderValue = opts.round(ret.AvgOrderValue)
+			r.Retention = &ret
+		}
+		out[i] = r
+	}
+	return out
+}
+
+// roundTriangle renvoie une copie du triangle aux montants arrondis selon opts.
+func roundTriangle(rows []models.CohortTriangle, opts Options) []models.CohortTriangle {
+	if rows == nil {
+		return nil
+	}
+	out := make([]models.CohortTriangle, len(rows))
+	for i, r := range rows {
+		cum := make([]models.Money, len(r.CumulativeLTV))
+		for k, v := range r.CumulativeLTV {
+			cum[k] = opts.round(v)
+		}
+		r.CumulativeLTV = cum
+		out[i] = r
+	}
+	return out
+}
@@ -0,0 +1,231 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"ltv-monthly/pkg/models"
+)
+
+var sample = []models.CohortResult{
+	{MonthYear: "01/2025", LTVAvg: models.MoneyFromFloat(25.5), CohortClients: 2, EventsRead: 3, RefundsAvg: models.MoneyFromFloat(5), NetLTVAvg: models.MoneyFromFloat(20.5), PeriodStart: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+	{MonthYear: "02/2025", LTVAvg: models.MoneyFromFloat(7), CohortClients: 1, EventsRead: 1, NetLTVAvg: models.MoneyFromFloat(7)},
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, in := range []string{"table", "CSV", "json", " jsonl "} {
+		if _, err := ParseFormat(in); err != nil {
+			t.Fatalf("%q: unexpected error: %v", in, err)
+		}
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Fatal("expected error for unknown format, got nil")
+	}
+}
+
+func TestWriteResults_CSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteResults(&buf, FormatCSV, sample, Options{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "month,ltv_avg,cohort_clients,events,refunds_avg,net_ltv_avg,period_start\n01/2025,25.500000,2,3,5.000000,20.500000,2025-01-01\n02/2025,7.000000,1,1,0.000000,7.000000,\n"
+	if buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestWriteResults_JSONL(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteResults(&buf, FormatJSONL, sample, Options{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+	var got map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+		t.Fatalf("invalid json line: %v", err)
+	}
+	for _, k := range []string{"month", "ltv_avg", "cohort_clients", "events", "refunds_avg", "net_ltv_avg", "period_start"} {
+		if _, ok := got[k]; !ok {
+			t.Fatalf("missing field %q in %s", k, lines[0])
+		}
+	}
+}
+
+func TestWriteResults_TableDetails(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteResults(&buf, FormatTable, sample[:1], Options{ShowCalculationDetails: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := " month ; ltv_avg_gross_on_period ; cohort_clients ; events\n01/2025 ; 25.500000 ; 2 ; 3\n"
+	if buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestWriteResults_TableNet(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteResults(&buf, FormatTable, sample[:1], Options{ShowNet: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := " month ; ltv_avg_gross_on_period ; refunds_avg ; ltv_avg_net_on_period\n01/2025 ; 25.500000 ; 5.000000 ; 20.500000\n"
+	if buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestWriteTriangle_CSV(t *testing.T) {
+	rows := []models.CohortTriangle{
+		{MonthYear: "01/2025", CohortClients: 2, CumulativeLTV: []models.Money{models.MoneyFromFloat(20), models.MoneyFromFloat(25)}},
+		{MonthYear: "02/2025", CohortClients: 1, CumulativeLTV: []models.Money{models.MoneyFromFloat(7)}},
+	}
+	var buf bytes.Buffer
+	if err := WriteTriangle(&buf, FormatCSV, rows, Options{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "month,cohort_clients,m0,m1\n01/2025,2,20.000000,25.000000\n02/2025,1,7.000000,\n"
+	if buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestWriteResults_CSVSegments(t *testing.T) {
+	rows := []models.CohortResult{
+		{MonthYear: "01/2025", Segments: map[string]string{"$.channel": "web"}, LTVAvg: models.MoneyFromFloat(10), CohortClients: 1, EventsRead: 1, NetLTVAvg: models.MoneyFromFloat(10)},
+	}
+	var buf bytes.Buffer
+	if err := WriteResults(&buf, FormatCSV, rows, Options{SegmentBy: []string{"$.channel"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "month,$.channel,ltv_avg,cohort_clients,events,refunds_avg,net_ltv_avg,period_start\n01/2025,web,10.000000,1,1,0.000000,10.000000,\n"
+	if buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestWriteResults_Rounding(t *testing.T) {
+	rows := []models.CohortResult{{MonthYear: "01/2025", LTVAvg: models.MoneyFromFloat(2.125), CohortClients: 1, NetLTVAvg: models.MoneyFromFloat(2.135)}}
+	for _, tc := range []struct {
+		mode models.RoundingMode
+		want string
+	}{
+		{models.RoundHalfEven, "01/2025,2.12,1,0,0.00,2.14,\n"},
+		{models.RoundHalfUp, "01/2025,2.13,1,0,0.00,2.14,\n"},
+	} {
+		var buf bytes.Buffer
+		if err := WriteResults(&buf, FormatCSV, rows, Options{Decimals: 2, Rounding: tc.mode}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got := strings.SplitN(buf.String(), "\n", 2)[1]
+		if got != tc.want {
+			t.Fatalf("%s: got %q, want %q", tc.mode, got, tc.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteResults(&buf, FormatJSON, rows, Options{Decimals: 2}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"ltv_avg": 2.12,`) {
+		t.Fatalf("json not rounded: %s", buf.String())
+	}
+}
+
+func TestWriteResults_CSVUnconverted(t *testing.T) {
+	rows := []models.CohortResult{{MonthYear: "01/2025", CohortClients: 1, UnconvertedEvents: 2}}
+	var buf bytes.Buffer
+	if err := WriteResults(&buf, FormatCSV, rows, Options{Decimals: 2, ShowUnconverted: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "month,ltv_avg,cohort_clients,events,refunds_avg,net_ltv_avg,period_start,unconverted_events\n01/2025,0.00,1,0,0.00,0.00,,2\n"
+	if buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestWriteResults_CSVPredicted(t *testing.T) {
+	rows := []models.CohortResult{{
+		MonthYear: "01/2025", LTVAvg: models.MoneyFromFloat(10), CohortClients: 1, NetLTVAvg: models.MoneyFromFloat(10),
+		Predicted: []models.PredictedLTV{{Months: 6, LTVAvg: models.MoneyFromFloat(12.345)}, {Months: 12, LTVAvg: models.MoneyFromFloat(14)}},
+	}}
+	var buf bytes.Buffer
+	if err := WriteResults(&buf, FormatCSV, rows, Options{Decimals: 2, PredictHorizons: []int{6, 12}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "month,ltv_avg,cohort_clients,events,refunds_avg,net_ltv_avg,period_start,predicted_ltv_6m,predicted_ltv_12m\n" +
+		"01/2025,10.00,1,0,0.00,10.00,,12.34,14.00\n"
+	if buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestWriteResults_CSVRetention(t *testing.T) {
+	rows := []models.CohortResult{
+		{MonthYear: "01/2025", CohortClients: 2, Retention: &models.Retention{
+			ActiveCustomers: []int{2, 1}, RetentionRate: []float64{1, 0.5}, RepeatPurchaseRate: 0.5, AvgOrders: 1.5, AvgOrderValue: 16_666_667,
+		}},
+		{MonthYear: "02/2025", CohortClients: 1, Retention: &models.Retention{
+			ActiveCustomers: []int{1}, RetentionRate: []float64{1}, AvgOrders: 1, AvgOrderValue: models.MoneyFromFloat(7),
+		}},
+	}
+	var buf bytes.Buffer
+	if err := WriteResults(&buf, FormatCSV, rows, Options{Decimals: 2, ShowRetention: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "month,ltv_avg,cohort_clients,events,refunds_avg,net_ltv_avg,period_start,repeat_purchase_rate,avg_orders,avg_order_value,retention_m0,retention_m1\n" +
+		"01/2025,0.00,2,0,0.00,0.00,,0.5000,1.5000,16.67,1.0000,0.5000\n" +
+		"02/2025,0.00,1,0,0.00,0.00,,0.0000,1.0000,7.00,1.0000,\n"
+	if buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestWriteResults_TableDistribution(t *testing.T) {
+	rows := []models.CohortResult{{
+		MonthYear: "01/2025", LTVAvg: models.MoneyFromFloat(25), CohortClients: 2,
+		Distribution: &models.Distribution{
+			Median: models.MoneyFromFloat(25), P25: models.MoneyFromFloat(22.5), P75: models.MoneyFromFloat(27.5),
+			P90: models.MoneyFromFloat(29), P99: models.MoneyFromFloat(29.9), StdDev: models.MoneyFromFloat(5),
+			Top1Share: 0.6, Top10Share: 0.6, AdjustedAvg: models.MoneyFromFloat(20),
+		},
+	}}
+	var buf bytes.Buffer
+	if err := WriteResults(&buf, FormatTable, rows, Options{Decimals: 1, ShowDistribution: true, ShowAdjusted: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := " month ; ltv_avg_gross_on_period ; median ; p25 ; p75 ; p90 ; p99 ; stddev ; top1_share ; top10_share ; adjusted_avg\n" +
+		"01/2025 ; 25.0 ; 25.0 ; 22.5 ; 27.5 ; 29.0 ; 29.9 ; 5.0 ; 0.6000 ; 0.6000 ; 20.0\n"
+	if buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestWriteResults_ConfidenceInterval(t *testing.T) {
+	rows := []models.CohortResult{
+		{MonthYear: "01/2025", LTVAvg: models.MoneyFromFloat(25), CohortClients: 2,
+			LTVCI: &models.Interval{Low: models.MoneyFromFloat(20.004), High: models.MoneyFromFloat(29.996), Level: 0.95}},
+		{MonthYear: "02/2025"},
+	}
+	var buf bytes.Buffer
+	if err := WriteResults(&buf, FormatCSV, rows, Options{Decimals: 2, ShowCI: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "month,ltv_avg,cohort_clients,events,refunds_avg,net_ltv_avg,period_start,ltv_ci_low,ltv_ci_high\n" +
+		"01/2025,25.00,2,0,0.00,0.00,,20.00,30.00\n02/2025,0.00,0,0,0.00,0.00,,,\n"
+	if buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := WriteResults(&buf, FormatJSONL, rows[:1], Options{Decimals: 2}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"ltv_ci":{"low":20,"high":30,"level":0.95}`) {
+		t.Fatalf("missing ltv_ci in %s", buf.String())
+	}
+}
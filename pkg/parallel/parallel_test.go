@@ -0,0 +1,30 @@
+package parallel
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestForEach_FirstError(t *testing.T) {
+	boom := errors.New("boom")
+	var mu sync.Mutex
+	seen := 0
+	err := ForEach(context.Background(), 50, 4, func(ctx context.Context, i int) error {
+		mu.Lock()
+		seen++
+		mu.Unlock()
+		if i == 3 {
+			return boom
+		}
+		<-ctx.Done() // les autres appels attendent l'annulation
+		return ctx.Err()
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("got %v, want boom", err)
+	}
+	if seen == 50 {
+		t.Fatal("expected the distribution to stop after the first error")
+	}
+}
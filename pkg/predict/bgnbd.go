@@ -0,0 +1,103 @@
+package predict
+
+import (
+	"fmt"
+	"math"
+)
+
+// BGNBD contient les paramètres du modèle BG/NBD :
+// taux d'achat λ ~ Gamma(R, Alpha), probabilité d'attrition après chaque achat p ~ Beta(A, B).
+type BGNBD struct {
+	R, Alpha, A, B float64
+}
+
+// rfKey regroupe les clients au résumé (x, t_x, T) identique : la vraisemblance est pondérée par leur nombre.
+type rfKey struct {
+	x     int
+	tx, T float64
+}
+
+// FitBGNBD ajuste BG/NBD par maximum de vraisemblance (Nelder-Mead sur le log des paramètres).
+func FitBGNBD(customers []Customer) (BGNBD, error) {
+	groups := make(map[rfKey]float64, len(customers))
+	repeat := false
+	for _, c := range customers {
+		if c.T <= 0 {
+			continue
+		}
+		groups[rfKey{c.Frequency, c.Recency, c.T}]++
+		repeat = repeat || c.Frequency > 0
+	}
+	if !repeat {
+		return BGNBD{}, ErrNotEnoughData
+	}
+	keys := make([]rfKey, 0, len(groups))
+	weights := make([]float64, 0, len(groups))
+	var n float64
+	for k, w := range groups {
+		keys = append(keys, k)
+		weights = append(weights, w)
+		n += w
+	}
+
+	nll := func(theta []float64) float64 {
+		if !inBounds(theta) {
+			return math.Inf(1)
+		}
+		m := BGNBD{R: math.Exp(theta[0]), Alpha: math.Exp(theta[1]), A: math.Exp(theta[2]), B: math.Exp(theta[3])}
+		var ll float64
+		for i, k := range keys {
+			ll += weights[i] * m.logLikelihood(k.x, k.tx, k.T)
+		}
+		return -ll / n
+	}
+	theta, v := nelderMead(nll, []float64{0, 0, 0, 0}, 4000, 1e-10)
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		return BGNBD{}, fmt.Errorf("predict: BG/NBD ne converge pas")
+	}
+	return BGNBD{R: math.Exp(theta[0]), Alpha: math.Exp(theta[1]), A: math.Exp(theta[2]), B: math.Exp(theta[3])}, nil
+}
+
+// logLikelihood renvoie la log-vraisemblance individuelle (Fader, Hardie & Lee 2005, éq. 6).
+func (m BGNBD) logLikelihood(x int, tx, T float64) float64 {
+	fx := float64(x)
+	a1 := lgamma(m.R+fx) - lgamma(m.R) + m.R*math.Log(m.Alpha)
+	a2 := lbeta(m.A, m.B+fx) - lbeta(m.A, m.B)
+	a3 := -(m.R + fx) * math.Log(m.Alpha+T)
+	if x == 0 {
+		return a1 + a2 + a3
+	}
+	a4 := math.Log(m.A) - math.Log(m.B+fx-1) - (m.R+fx)*math.Log(m.Alpha+tx)
+	return a1 + a2 + logSumExp(a3, a4)
+}
+
+// ExpectedPurchases renvoie le nombre d'achats attendus du client sur les t semaines suivant l'observation
+// (espérance conditionnelle à son historique, éq. 10).
+func (m BGNBD) ExpectedPurchases(c Customer, t float64) float64 {
+	if t <= 0 {
+		return 0
+	}
+	x := float64(c.Frequency)
+	z := t / (m.Alpha + c.T + t)
+	// ((α+T)/(α+T+t))^(r+x) · 2F1(r+x, b+x; a+b+x-1; z) réécrit par la transformation d'Euler
+	// h = (1-z)^(a-1) · 2F1(a+b-1-r, a-1; a+b+x-1; z) : séries bornées quel que soit x.
+	// (1-h)/(a-1) est calculé sous la forme -expm1(ε·l)/ε, ε = a-1 et l = log(h)/ε, sans perte de précision
+	// près de a = 1 et avec sa limite exacte en a = 1.
+	e := m.A - 1
+	l := math.Log1p(-z) + divLimit(math.Log1p, e, hyp2f1Tail(m.A+m.B-1-m.R, e, m.A+m.B+x-1, z))
+	num := -(m.A + m.B + x - 1) * divLimit(math.Expm1, e, l)
+	den := 1.0
+	if c.Frequency > 0 {
+		den += m.A / (m.B + x - 1) * math.Exp((m.R+x)*(math.Log(m.Alpha+c.T)-math.Log(m.Alpha+c.Recency)))
+	}
+	return num / den
+}
+
+// ProbAlive renvoie la probabilité que le client soit toujours actif à l'observation.
+func (m BGNBD) ProbAlive(c Customer) float64 {
+	if c.Frequency == 0 {
+		return 1
+	}
+	x := float64(c.Frequency)
+	return 1 / (1 + m.A/(m.B+x-1)*math.Exp((m.R+x)*(math.Log(m.Alpha+c.T)-math.Log(m.Alpha+c.Recency))))
+}
@@ -0,0 +1,63 @@
+package predict
+
+import (
+	"fmt"
+	"math"
+)
+
+// GammaGamma contient les paramètres du modèle Gamma-Gamma : montant d'un achat ~ Gamma(P, ν),
+// ν ~ Gamma(Q, Gamma) propre à chaque client. La moyenne de population vaut P·Gamma/(Q-1).
+type GammaGamma struct {
+	P, Q, Gamma float64
+}
+
+// FitGammaGamma ajuste Gamma-Gamma sur les clients ayant au moins un achat répété de valeur positive.
+func FitGammaGamma(customers []Customer) (GammaGamma, error) {
+	var xs, ms []float64
+	for _, c := range customers {
+		if c.Frequency > 0 && c.Monetary > 0 {
+			xs = append(xs, float64(c.Frequency))
+			ms = append(ms, c.Monetary)
+		}
+	}
+	if len(xs) == 0 {
+		return GammaGamma{}, ErrNotEnoughData
+	}
+
+	nll := func(theta []float64) float64 {
+		if !inBounds(theta) {
+			return math.Inf(1)
+		}
+		p, q, g := math.Exp(theta[0]), math.Exp(theta[1]), math.Exp(theta[2])
+		var ll float64
+		for i, x := range xs {
+			m := ms[i]
+			ll += lgamma(p*x+q) - lgamma(p*x) - lgamma(q) + q*math.Log(g) +
+				(p*x-1)*math.Log(m) + p*x*math.Log(x) - (p*x+q)*math.Log(x*m+g)
+		}
+		return -ll / float64(len(xs))
+	}
+	theta, v := nelderMead(nll, []float64{0, 0, 0}, 4000, 1e-10)
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		return GammaGamma{}, fmt.Errorf("predict: Gamma-Gamma ne converge pas")
+	}
+	return GammaGamma{P: math.Exp(theta[0]), Q: math.Exp(theta[1]), Gamma: math.Exp(theta[2])}, nil
+}
+
+// ExpectedAverageValue renvoie la valeur moyenne attendue d'un achat futur du client :
+// moyenne pondérée entre la moyenne de population et sa moyenne observée m_x.
+func (m GammaGamma) ExpectedAverageValue(c Customer) float64 {
+	x := float64(c.Frequency)
+	if c.Frequency == 0 || c.Monetary <= 0 {
+		return m.PopulationMean()
+	}
+	return m.P * (m.Gamma + x*c.Monetary) / (m.P*x + m.Q - 1)
+}
+
+// PopulationMean renvoie la valeur moyenne d'un achat dans la population (Q > 1), 0 sinon.
+func (m GammaGamma) PopulationMean() float64 {
+	if m.Q <= 1 {
+		return 0
+	}
+	return m.P * m.Gamma / (m.Q - 1)
+}
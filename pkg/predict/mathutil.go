@@ -0,0 +1,160 @@
+package predict
+
+import (
+	"math"
+	"sort"
+)
+
+// logBound borne le log des paramètres ajustés : hors de [e^-12, e^12] le modèle est dégénéré.
+const logBound = 12
+
+func inBounds(theta []float64) bool {
+	for _, v := range theta {
+		if v < -logBound || v > logBound || math.IsNaN(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func lgamma(x float64) float64 {
+	v, _ := math.Lgamma(x)
+	return v
+}
+
+// lbeta renvoie ln B(a, b).
+func lbeta(a, b float64) float64 {
+	return lgamma(a) + lgamma(b) - lgamma(a+b)
+}
+
+// logSumExp renvoie ln(e^a + e^b) sans dépassement.
+func logSumExp(a, b float64) float64 {
+	if a < b {
+		a, b = b, a
+	}
+	return a + math.Log1p(math.Exp(b-a))
+}
+
+// hyp2f1 évalue la fonction hypergéométrique de Gauss 2F1(a, b; c; z) par sa série, pour 0 <= z < 1.
+func hyp2f1(a, b, c, z float64) float64 {
+	sum, term := 1.0, 1.0
+	for k := 0.0; k < 100000; k++ {
+		term *= (a + k) * (b + k) / ((c + k) * (k + 1)) * z
+		sum += term
+		if math.Abs(term) <= 1e-14*math.Abs(sum) {
+			break
+		}
+	}
+	return sum
+}
+
+// hyp2f1Tail renvoie (2F1(a, e; c; z) - 1) / e, calculé terme à terme (chaque terme de la série contient
+// le facteur e) : exact quand e tend vers 0.
+func hyp2f1Tail(a, e, c, z float64) float64 {
+	term := a * z / c
+	sum := term
+	for k := 1.0; k < 100000; k++ {
+		term *= (a + k) * (e + k) / ((c + k) * (k + 1)) * z
+		sum += term
+		if math.Abs(term) <= 1e-14*math.Abs(sum) {
+			break
+		}
+	}
+	return sum
+}
+
+// divLimit renvoie f(e·v)/e pour f telle que f(0) = 0 et f'(0) = 1 (log1p, expm1), ou sa limite v si e·v = 0.
+func divLimit(f func(float64) float64, e, v float64) float64 {
+	if e*v == 0 {
+		return v
+	}
+	return f(e*v) / e
+}
+
+// nelderMead minimise f depuis x0 par la méthode du simplexe de Nelder-Mead ;
+// renvoie le meilleur point et sa valeur après convergence (écart des valeurs < tol) ou maxIter itérations.
+func nelderMead(f func([]float64) float64, x0 []float64, maxIter int, tol float64) ([]float64, float64) {
+	n := len(x0)
+	pts := make([][]float64, n+1)
+	vals := make([]float64, n+1)
+	for i := range pts {
+		p := append([]float64(nil), x0...)
+		if i > 0 {
+			p[i-1] += 0.5
+		}
+		pts[i], vals[i] = p, f(p)
+	}
+
+	// combine renvoie c + t·(c - w).
+	combine := func(c, w []float64, t float64) []float64 {
+		out := make([]float64, n)
+		for j := range out {
+			out[j] = c[j] + t*(c[j]-w[j])
+		}
+		return out
+	}
+
+	idx := make([]int, n+1)
+	for iter := 0; iter < maxIter; iter++ {
+		for i := range idx {
+			idx[i] = i
+		}
+		sort.Slice(idx, func(i, j int) bool { return vals[idx[i]] < vals[idx[j]] })
+		sp, sv := make([][]float64, n+1), make([]float64, n+1)
+		for i, k := range idx {
+			sp[i], sv[i] = pts[k], vals[k]
+		}
+		pts, vals = sp, sv
+
+		if math.Abs(vals[n]-vals[0]) <= tol*(math.Abs(vals[0])+tol) {
+			break
+		}
+
+		centroid := make([]float64, n)
+		for _, p := range pts[:n] {
+			for j := range centroid {
+				centroid[j] += p[j] / float64(n)
+			}
+		}
+		worst := pts[n]
+
+		r := combine(centroid, worst, 1)
+		fr := f(r)
+		switch {
+		case fr < vals[0]:
+			e := combine(centroid, worst, 2)
+			if fe := f(e); fe < fr {
+				pts[n], vals[n] = e, fe
+			} else {
+				pts[n], vals[n] = r, fr
+			}
+		case fr < vals[n-1]:
+			pts[n], vals[n] = r, fr
+		default:
+			t := 0.5 // contraction extérieure
+			if fr >= vals[n] {
+				t = -0.5 // contraction intérieure
+			}
+			c := combine(centroid, worst, t)
+			if fc := f(c); fc < math.Min(fr, vals[n]) {
+				pts[n], vals[n] = c, fc
+				continue
+			}
+			// réduction vers le meilleur point
+			for i := 1; i <= n; i++ {
+				for j := range pts[i] {
+					pts[i][j] = pts[0][j] + 0.5*(pts[i][j]-pts[0][j])
+				}
+				vals[i] = f(pts[i])
+			}
+		}
+	}
+
+	best := 0
+	for i := range vals {
+		if vals[i] < vals[best] {
+			best = i
+		}
+	}
+	return pts[best], vals[best]
+}
@@ -0,0 +1,164 @@
+package predict
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// gammaRand tire une loi Gamma(shape, scale) (Marsaglia & Tsang).
+func gammaRand(rng *rand.Rand, shape, scale float64) float64 {
+	if shape < 1 {
+		return gammaRand(rng, shape+1, scale) * math.Pow(rng.Float64(), 1/shape)
+	}
+	d := shape - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := rng.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := rng.Float64()
+		if math.Log(u) < 0.5*x*x+d-d*v+d*math.Log(v) {
+			return d * v * scale
+		}
+	}
+}
+
+func betaRand(rng *rand.Rand, a, b float64) float64 {
+	x := gammaRand(rng, a, 1)
+	return x / (x + gammaRand(rng, b, 1))
+}
+
+// simulate génère n clients BG/NBD (params tx) observés T semaines, avec des montants Gamma-Gamma (params v).
+func simulate(rng *rand.Rand, n int, T float64, tx BGNBD, v GammaGamma) []Customer {
+	out := make([]Customer, n)
+	for i := range out {
+		lambda := gammaRand(rng, tx.R, 1/tx.Alpha)
+		p := betaRand(rng, tx.A, tx.B)
+		nu := gammaRand(rng, v.Q, 1/v.Gamma)
+		c := Customer{T: T}
+		var t, total float64
+		for {
+			t += rng.ExpFloat64() / lambda
+			if t > T {
+				break
+			}
+			c.Frequency++
+			c.Recency = t
+			total += gammaRand(rng, v.P, 1/nu)
+			if rng.Float64() < p {
+				break
+			}
+		}
+		if c.Frequency > 0 {
+			c.Monetary = total / float64(c.Frequency)
+		}
+		out[i] = c
+	}
+	return out
+}
+
+func TestHyp2f1(t *testing.T) {
+	// 2F1(1, 1; 2; z) = -ln(1-z)/z
+	for _, z := range []float64{0.1, 0.5, 0.9} {
+		if got, want := hyp2f1(1, 1, 2, z), -math.Log(1-z)/z; math.Abs(got-want) > 1e-9 {
+			t.Fatalf("z=%v: got %v, want %v", z, got, want)
+		}
+	}
+}
+
+func TestFit_RecoversSimulatedParameters(t *testing.T) {
+	truthTx := BGNBD{R: 0.25, Alpha: 4, A: 0.8, B: 2.5}
+	truthV := GammaGamma{P: 6, Q: 4, Gamma: 15}
+	customers := simulate(rand.New(rand.NewSource(42)), 4000, 52, truthTx, truthV)
+
+	m, err := Fit(customers)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// maximum de vraisemblance : au moins aussi vraisemblable que les vrais paramètres
+	ll := func(p BGNBD) (s float64) {
+		for _, c := range customers {
+			s += p.logLikelihood(c.Frequency, c.Recency, c.T)
+		}
+		return s
+	}
+	if ll(m.Transactions) < ll(truthTx)-1e-6 {
+		t.Fatalf("fitted BG/NBD %+v less likely than truth", m.Transactions)
+	}
+	// taux d'achat moyen r/α retrouvé à 20 % près
+	if got, want := m.Transactions.R/m.Transactions.Alpha, truthTx.R/truthTx.Alpha; math.Abs(got-want) > 0.2*want {
+		t.Fatalf("purchase rate r/alpha: got %v, want ~%v (%+v)", got, want, m.Transactions)
+	}
+	// valeur moyenne d'un achat retrouvée à 15 % près
+	if got, want := m.Value.PopulationMean(), truthV.PopulationMean(); math.Abs(got-want) > 0.15*want {
+		t.Fatalf("population mean value: got %v, want ~%v (%+v)", got, want, m.Value)
+	}
+}
+
+func TestExpectedRevenue(t *testing.T) {
+	m := Model{
+		Transactions: BGNBD{R: 0.25, Alpha: 4, A: 0.8, B: 2.5},
+		Value:        GammaGamma{P: 6, Q: 4, Gamma: 15},
+	}
+	active := Customer{Frequency: 5, Recency: 50, T: 52, Monetary: 40}
+	churned := Customer{Frequency: 5, Recency: 5, T: 52, Monetary: 40}
+	if m.Transactions.ProbAlive(active) <= m.Transactions.ProbAlive(churned) {
+		t.Fatal("recent buyer should be more likely alive")
+	}
+	r6, r12 := m.ExpectedRevenue(active, 6), m.ExpectedRevenue(active, 12)
+	if r6 <= 0 || r12 <= r6 {
+		t.Fatalf("expected revenue should grow with horizon: 6m=%v 12m=%v", r6, r12)
+	}
+	if got := m.ExpectedRevenue(churned, 12); got >= r12 {
+		t.Fatalf("churned customer revenue %v should be below active %v", got, r12)
+	}
+	if got := m.ExpectedRevenue(active, 0); got != 0 {
+		t.Fatalf("zero horizon: got %v", got)
+	}
+}
+
+func TestExpectedPurchases_ANearOne(t *testing.T) {
+	customers := []Customer{{Frequency: 0, T: 30}, {Frequency: 4, Recency: 40, T: 52}}
+	// formule directe (éq. 10 après transformation d'Euler), valable loin de a = 1
+	direct := func(m BGNBD, c Customer, t float64) float64 {
+		x := float64(c.Frequency)
+		z := t / (m.Alpha + c.T + t)
+		h := math.Pow(1-z, m.A-1) * hyp2f1(m.A+m.B-1-m.R, m.A-1, m.A+m.B+x-1, z)
+		num := (m.A + m.B + x - 1) / (m.A - 1) * (1 - h)
+		den := 1.0
+		if c.Frequency > 0 {
+			den += m.A / (m.B + x - 1) * math.Exp((m.R+x)*(math.Log(m.Alpha+c.T)-math.Log(m.Alpha+c.Recency)))
+		}
+		return num / den
+	}
+	for _, c := range customers {
+		for _, a := range []float64{0.8, 2} {
+			m := BGNBD{R: 0.25, Alpha: 4, A: a, B: 2.5}
+			if got, want := m.ExpectedPurchases(c, 26), direct(m, c, 26); math.Abs(got-want) > 1e-9*want {
+				t.Fatalf("a=%v %+v: got %v, want %v", a, c, got, want)
+			}
+		}
+		// a = 1 : limite finie, continue de part et d'autre
+		at := BGNBD{R: 0.25, Alpha: 4, A: 1, B: 2.5}.ExpectedPurchases(c, 26)
+		if math.IsNaN(at) || math.IsInf(at, 0) || at <= 0 {
+			t.Fatalf("a=1 %+v: got %v", c, at)
+		}
+		for _, a := range []float64{1 - 1e-9, 1 + 1e-9, 1 - 1e-4, 1 + 1e-4} {
+			got := BGNBD{R: 0.25, Alpha: 4, A: a, B: 2.5}.ExpectedPurchases(c, 26)
+			if math.Abs(got-at) > 1e-3*at {
+				t.Fatalf("a=%v %+v: got %v, want ~%v", a, c, got, at)
+			}
+		}
+	}
+}
+
+func TestFit_NotEnoughData(t *testing.T) {
+	if _, err := Fit([]Customer{{T: 10}, {T: 20}}); err != ErrNotEnoughData {
+		t.Fatalf("got %v, want ErrNotEnoughData", err)
+	}
+}
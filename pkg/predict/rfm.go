@@ -0,0 +1,57 @@
+// Package predict estime la LTV future des clients avec les modèles BG/NBD (fréquence d'achat et attrition)
+// et Gamma-Gamma (valeur monétaire), à partir du résumé RFM de chaque client.
+//
+// Références : Fader, Hardie & Lee, "Counting Your Customers the Easy Way: An Alternative to the
+// Pareto/NBD Model" (2005) et "RFM and CLV: Using Iso-Value Curves for Customer Base Analysis" (2005).
+package predict
+
+import (
+	"errors"
+	"math"
+)
+
+// WeeksPerMonth convertit un horizon en mois dans l'unité de temps des modèles (semaines).
+const WeeksPerMonth = 365.25 / 12 / 7
+
+// Customer est le résumé RFM d'un client, en semaines.
+type Customer struct {
+	Frequency int     // x : nombre d'achats répétés (jours d'achat distincts après le premier)
+	Recency   float64 // t_x : âge du client à son dernier achat (0 sans achat répété)
+	T         float64 // âge du client à la date d'observation
+	Monetary  float64 // m_x : valeur moyenne des achats répétés (0 sans achat répété)
+}
+
+// Model combine BG/NBD et Gamma-Gamma pour estimer le revenu futur d'un client.
+type Model struct {
+	Transactions BGNBD
+	Value        GammaGamma
+}
+
+// ErrNotEnoughData signale un échantillon insuffisant (aucun achat répété) pour ajuster les modèles.
+var ErrNotEnoughData = errors.New("predict: pas assez d'achats répétés pour ajuster les modèles")
+
+// Fit ajuste les deux modèles sur les clients donnés.
+func Fit(customers []Customer) (Model, error) {
+	tx, err := FitBGNBD(customers)
+	if err != nil {
+		return Model{}, err
+	}
+	v, err := FitGammaGamma(customers)
+	if err != nil {
+		return Model{}, err
+	}
+	return Model{Transactions: tx, Value: v}, nil
+}
+
+// ExpectedRevenue renvoie le revenu attendu du client sur les months mois suivant l'observation
+// (non actualisé) : achats attendus × valeur moyenne attendue.
+func (m Model) ExpectedRevenue(c Customer, months int) float64 {
+	if months <= 0 {
+		return 0
+	}
+	v := m.Transactions.ExpectedPurchases(c, float64(months)*WeeksPerMonth) * m.Value.ExpectedAverageValue(c)
+	if math.IsNaN(v) || math.IsInf(v, 0) || v < 0 {
+		return 0
+	}
+	return v
+}
@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"ltv-monthly/pkg/calculator"
+	"ltv-monthly/pkg/database"
+	"ltv-monthly/pkg/models"
+	"ltv-monthly/pkg/predict"
+)
+
+// maxBootstrapIterations borne le coût d'une requête /ltv.
+const maxBootstrapIterations = 10000
+
+// Pinger est implémenté par *sql.DB ; il sert au endpoint de santé.
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// Server expose le calcul de LTV par cohorte en HTTP.
+type Server struct {
+	src  calculator.EventSource
+	db   Pinger
+	base models.Config // paramètres par défaut (Verbose, ChunkSize, LoadWorkers, ...)
+}
+
+// New construit le serveur ; base fournit les paramètres par défaut, dont seuls Granularity et SegmentBy
+// sont surchargeables par requête.
+func New(src calculator.EventSource, db Pinger, base models.Config) *Server {
+	return &Server{src: src, db: db, base: base}
+}
+
+// Handler renvoie le routeur HTTP :
+//   - GET /ltv?start_month=MMYYYY&end_month=MMYYYY[&mode=...][&observation=...][&granularity=...][&segment_by=$.path...][&predict=6&predict=12...][&retention=true][&distribution=true][&outliers=trim:0.99]
+//     [&bootstrap=1000][&confidence=0.95][&seed=1]
+//     → []CohortResult en JSON
+//   - GET /healthz → 200 si la base répond au ping
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ltv", s.handleLTV)
+	mux.HandleFunc("/healthz", s.handleHealth)
+	return mux
+}
+
+func (s *Server) handleLTV(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("méthode non autorisée"))
+		return
+	}
+	start := time.Now()
+	q := r.URL.Query()
+
+	cfg := s.base
+	cfg.StartMonthInclusive = q.Get("start_month")
+	cfg.EndMonthInclusive = q.Get("end_month")
+	if cfg.StartMonthInclusive == "" || cfg.EndMonthInclusive == "" {
+		writeError(w, http.StatusBadRequest, errors.New("start_month et end_month sont requis (MMYYYY)"))
+		return
+	}
+	// granularity et segment_by absents : valeurs de base (flags de `serve`)
+	if q.Has("granularity") {
+		if _, err := calculator.ParseGranularity(q.Get("granularity")); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		cfg.Granularity = q.Get("granularity")
+	}
+	if q.Has("segment_by") {
+		cfg.SegmentBy = q["segment_by"]
+		if err := database.CheckSegmentPaths(cfg.SegmentBy); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	cfg.PredictHorizons = nil
+	for _, v := range q["predict"] {
+		h, err := strconv.Atoi(v)
+		if err != nil || h <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("predict: horizon invalide %q (mois > 0)", v))
+			return
+		}
+		cfg.PredictHorizons = append(cfg.PredictHorizons, h)
+	}
+	cfg.Retention = false
+	if v := q.Get("retention"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("retention: booléen invalide %q", v))
+			return
+		}
+		cfg.Retention = b
+	}
+	cfg.Distribution = false
+	if v := q.Get("distribution"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("distribution: booléen invalide %q", v))
+			return
+		}
+		cfg.Distribution = b
+	}
+	outliers, err := calculator.ParseOutlierPolicy(q.Get("outliers"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	cfg.Outliers = outliers
+	cfg.Distribution = cfg.Distribution || outliers.Method != ""
+	if cfg.Bootstrap, err = parseBootstrap(q); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	cfg.Observation = time.Time{}
+	if v := q.Get("observation"); v != "" {
+		obs, err := calculator.ParseObservation(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		cfg.Observation = obs
+	}
+	mode := q.Get("mode")
+	runner, err := calculator.RunnerFor(mode)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	// erreurs de saisie détectées avant le calcul : 400 plutôt qu'un échec du runner en 500
+	if _, _, err := calculator.ParsePeriod(cfg); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if mode == calculator.ModePushdown {
+		if err := calculator.CheckPushdown(cfg); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	// r.Context() est annulé si le client se déconnecte : les QueryContext des loaders s'interrompent.
+	results, err := runner(r.Context(), s.src, cfg)
+	if err != nil {
+		if r.Context().Err() != nil {
+			log.Printf("[WARN] [HTTP] /ltv canceled: %v", r.Context().Err())
+			return
+		}
+		if errors.Is(err, predict.ErrNotEnoughData) {
+			writeError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		// le détail (requêtes, chemins, base) reste dans les logs du serveur
+		log.Printf("[ERROR] [HTTP] /ltv %s..%s mode=%s: %v", cfg.StartMonthInclusive, cfg.EndMonthInclusive, mode, err)
+		writeError(w, http.StatusInternalServerError, errors.New("erreur interne du calcul"))
+		return
+	}
+	if results == nil {
+		results = []models.CohortResult{}
+	}
+	writeJSON(w, http.StatusOK, results)
+
+	if s.base.Verbose {
+		log.Printf("[INFO] [HTTP] /ltv %s..%s mode=%s -> %d rows in %s",
+			cfg.StartMonthInclusive, cfg.EndMonthInclusive, mode, len(results), time.Since(start))
+	}
+}
+
+// parseBootstrap lit les paramètres bootstrap, confidence et seed ; sans bootstrap, l'intervalle est désactivé.
+func parseBootstrap(q url.Values) (models.Bootstrap, error) {
+	b := models.Bootstrap{Confidence: 0.95, Seed: 1}
+	if v := q.Get("bootstrap"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxBootstrapIterations {
+			return b, fmt.Errorf("bootstrap: nombre d'itérations invalide %q (0 à %d)", v, maxBootstrapIterations)
+		}
+		b.Iterations = n
+	}
+	if v := q.Get("confidence"); v != "" {
+		c, err := strconv.ParseFloat(v, 64)
+		if err != nil || c <= 0 || c >= 1 {
+			return b, fmt.Errorf("confidence: niveau invalide %q (dans ]0, 1[)", v)
+		}
+		b.Confidence = c
+	}
+	if v := q.Get("seed"); v != "" {
+		seed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return b, fmt.Errorf("seed: entier invalide %q", v)
+		}
+		b.Seed = seed
+	}
+	return b, nil
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+	if err := s.db.PingContext(ctx); err != nil {
+		// le détail du driver (hôte, DSN) reste dans les logs du serveur
+		log.Printf("[ERROR] [HTTP] /health: %v", err)
+		writeError(w, http.StatusServiceUnavailable, errors.New("base de données indisponible"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("[WARN] [HTTP] write response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
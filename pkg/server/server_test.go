@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ltv-monthly/pkg/models"
+)
+
+// stubSource renvoie toujours les mêmes événements, quel que soit le chargement demandé.
+type stubSource struct{ events []models.RawEventData }
+
+func (s stubSource) LoadOrderEvents(ctx context.Context, obsBefore time.Time, cfg models.Config) ([]models.RawEventData, error) {
+	return s.events, nil
+}
+
+func (s stubSource) StreamOrderEvents(ctx context.Context, obsBefore time.Time, cfg models.Config, fn func(models.RawEventData) error) error {
+	for _, ev := range s.events {
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s stubSource) LoadOrdersInsertDate(ctx context.Context, events []models.RawEventData, obsBefore time.Time, cfg models.Config) ([]models.RawEventsInsertDate, error) {
+	return nil, nil
+}
+
+func (s stubSource) LoadCohortCustomers(ctx context.Context, cohortStart, cohortEnd time.Time, cfg models.Config) ([]models.CohortCustomer, error) {
+	return nil, nil
+}
+
+func (s stubSource) LoadOrderEventsWithCustomersID(ctx context.Context, customers []models.CohortCustomer, obsBefore time.Time, cfg models.Config) ([]models.RawEventData, error) {
+	return nil, nil
+}
+
+type stubPinger struct{ err error }
+
+func (p stubPinger) PingContext(ctx context.Context) error { return p.err }
+
+func newTestServer(pingErr error) *Server {
+	src := stubSource{events: []models.RawEventData{
+		{EventID: 1, CustomerID: 1, EventDate: time.Date(2025, 1, 5, 0, 0, 0, 0, time.UTC), Quantity: 2, UnitPrice: models.MoneyFromFloat(10)},
+	}}
+	return New(src, stubPinger{err: pingErr}, models.Config{})
+}
+
+func TestHandleLTV_OK(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/ltv?start_month=012025&end_month=022025&observation=2025-03-01", nil)
+	newTestServer(nil).Handler().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, body %s", rec.Code, rec.Body.String())
+	}
+	var got []models.CohortResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if len(got) != 2 || got[0].LTVAvg != models.MoneyFromFloat(20) || got[0].CohortClients != 1 {
+		t.Fatalf("unexpected results: %+v", got)
+	}
+}
+
+func TestHandleLTV_BaseDefaults(t *testing.T) {
+	src := newTestServer(nil).src
+	s := New(src, stubPinger{}, models.Config{Granularity: "year"})
+	for url, want := range map[string]int{
+		"/ltv?start_month=012025&end_month=022025&observation=2025-03-01":                   1, // granularité de base
+		"/ltv?start_month=012025&end_month=022025&observation=2025-03-01&granularity=month": 2,
+	} {
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		var got []models.CohortResult
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || len(got) != want {
+			t.Fatalf("%s: got %d rows (%v), want %d: %s", url, len(got), err, want, rec.Body.String())
+		}
+	}
+}
+
+func TestHandleLTV_BadRequest(t *testing.T) {
+	for _, url := range []string{
+		"/ltv?start_month=012025",
+		"/ltv?start_month=012025&end_month=022025&mode=unknown",
+		"/ltv?start_month=012025&end_month=022025&observation=yesterday",
+		"/ltv?start_month=012025&end_month=022025&predict=0",
+		"/ltv?start_month=012025&end_month=022025&retention=maybe",
+		"/ltv?start_month=012025&end_month=022025&outliers=cap:0.9",
+		"/ltv?start_month=012025&end_month=022025&bootstrap=1000&confidence=95",
+		"/ltv?start_month=13AB&end_month=022025",
+		"/ltv?start_month=032025&end_month=022025",
+		"/ltv?start_month=012025&end_month=022025&mode=pushdown&retention=true",
+		"/ltv?start_month=012025&end_month=022025&mode=pushdown&segment_by=$.channel",
+	} {
+		rec := httptest.NewRecorder()
+		newTestServer(nil).Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: got status %d, want 400", url, rec.Code)
+		}
+	}
+}
+
+// failingSource échoue au chargement avec un message interne qui ne doit pas être renvoyé au client.
+type failingSource struct{ stubSource }
+
+func (failingSource) StreamOrderEvents(ctx context.Context, obsBefore time.Time, cfg models.Config, fn func(models.RawEventData) error) error {
+	return errors.New("Error 1146: Table 'datafy.CustomerEventData' doesn't exist")
+}
+
+func TestHandleLTV_InternalError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	s := New(failingSource{}, stubPinger{}, models.Config{})
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ltv?start_month=012025&end_month=022025", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("got status %d, want 500", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "CustomerEventData") {
+		t.Fatalf("internal error leaked to the client: %s", rec.Body.String())
+	}
+}
+
+func TestHandleHealth(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newTestServer(nil).Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	newTestServer(errors.New("dial tcp db.internal:3306: connection refused")).Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got status %d, want 503", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "db.internal") {
+		t.Fatalf("driver error leaked to the client: %s", rec.Body.String())
+	}
+}
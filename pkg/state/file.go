@@ -0,0 +1,93 @@
+// Package state persiste dans un fichier local l'état du calcul incrémental (calculator.RunIncremental).
+package state
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"ltv-monthly/pkg/models"
+)
+
+// formatVersion est incrémenté à chaque changement incompatible du contenu du fichier.
+const formatVersion = 1
+
+// FileStore enregistre l'état dans un fichier gob compressé ; l'écriture passe par un fichier
+// temporaire renommé, un calcul interrompu laisse donc l'état précédent intact.
+type FileStore struct {
+	Path string
+}
+
+// NewFileStore construit un FileStore pour path.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{Path: path}
+}
+
+// LoadState implémente calculator.StateStore : nil si le fichier n'existe pas encore.
+func (s *FileStore) LoadState(ctx context.Context) (*models.State, error) {
+	f, err := os.Open(s.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.Path, err)
+	}
+	dec := gob.NewDecoder(zr)
+	var version int
+	if err := dec.Decode(&version); err != nil {
+		return nil, fmt.Errorf("%s: %w", s.Path, err)
+	}
+	if version != formatVersion {
+		return nil, fmt.Errorf("%s: version d'état %d non supportée (attendu %d)", s.Path, version, formatVersion)
+	}
+	var st models.State
+	if err := dec.Decode(&st); err != nil {
+		return nil, fmt.Errorf("%s: %w", s.Path, err)
+	}
+	return &st, nil
+}
+
+// SaveState implémente calculator.StateStore.
+func (s *FileStore) SaveState(ctx context.Context, st *models.State) error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.Path), filepath.Base(s.Path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // sans effet après le renommage
+
+	bw := bufio.NewWriter(tmp)
+	zw := gzip.NewWriter(bw)
+	enc := gob.NewEncoder(zw)
+	err = enc.Encode(formatVersion)
+	if err == nil {
+		err = enc.Encode(st)
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.Path)
+}
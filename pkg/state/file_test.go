@@ -0,0 +1,49 @@
+package state
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"ltv-monthly/pkg/models"
+)
+
+func TestFileStore_RoundTrip(t *testing.T) {
+	store := NewFileStore(filepath.Join(t.TempDir(), "ltv.state"))
+	ctx := context.Background()
+
+	st, err := store.LoadState(ctx)
+	if err != nil || st != nil {
+		t.Fatalf("expected no state yet, got %+v, %v", st, err)
+	}
+
+	want := &models.State{
+		Observation: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+		Fingerprint: "abc",
+		EventsRead:  4,
+		Customers: []models.CustomerState{
+			{CustomerID: 1, First: time.Date(2025, 1, 5, 0, 0, 0, 0, time.UTC), FirstEventID: 1, Revenue: models.MoneyFromFloat(20), Events: 2, Segments: []string{"web"}},
+			{CustomerID: 9, Refunds: models.MoneyFromFloat(50)},
+		},
+	}
+	if err := store.SaveState(ctx, want); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := store.LoadState(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	if err := os.WriteFile(store.Path, []byte("not a state"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.LoadState(ctx); err == nil {
+		t.Fatal("expected error for a corrupted file, got nil")
+	}
+}